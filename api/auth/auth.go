@@ -0,0 +1,44 @@
+// Package auth works out who is calling the api from the credentials they
+// send, and carries the answer through the request context so handlers can
+// decide what the caller is allowed to do.
+package auth
+
+import (
+	"context"
+	"errors"
+
+	pbkey "github.com/alextebbs/counters/pb/key/v1"
+)
+
+// ErrInvalidCredentials is returned, wrapping the reason, for credentials
+// which are malformed, expired or signed by someone we don't trust. Callers
+// shouldn't be told which.
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// Who a request is from.
+type Principal struct {
+	// Identifies the user, the sub claim of their token. Stable across
+	// logins, so it's what anything they own is recorded against.
+	Subject string
+	// The API key the call was made with, which limits it to the key's scopes
+	// and counters. Nil when the user called as themselves.
+	Key *pbkey.Key
+}
+
+// Checks a bearer token, returning who it belongs to.
+type Authenticator interface {
+	Authenticate(ctx context.Context, token string) (*Principal, error)
+}
+
+type principalKey struct{}
+
+// NewContext returns a copy of ctx carrying p.
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the principal the auth interceptor put in ctx, if any.
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(*Principal)
+	return p, ok
+}
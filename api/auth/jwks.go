@@ -0,0 +1,187 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+)
+
+var errUnknownKey = errors.New("token is signed with a key that isn't in the key set")
+
+// The public keys from a JWKS file, by kid, as of when the file was last
+// modified.
+type keySet struct {
+	path    string
+	modTime time.Time
+	keys    map[string]jwk
+}
+
+// A single key from a JSON Web Key Set, see RFC 7517. Only the fields for the
+// public halves of RSA, EC and OKP (Ed25519) keys are read.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+
+	public crypto.PublicKey
+}
+
+func loadKeySet(path string) (*keySet, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS file: %w", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS file: %w", err)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("failed to parse JWKS file %s: %w", path, err)
+	}
+
+	keys := map[string]jwk{}
+	for i, k := range set.Keys {
+		// encryption keys have no business signing tokens
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		k.public, err = k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("JWKS file %s: key %d (kid %q): %w", path, i, k.Kid, err)
+		}
+		if _, ok := keys[k.Kid]; ok {
+			return nil, fmt.Errorf("JWKS file %s: more than one key has kid %q", path, k.Kid)
+		}
+		keys[k.Kid] = k
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("JWKS file %s has no signing keys", path)
+	}
+
+	return &keySet{path: path, modTime: info.ModTime(), keys: keys}, nil
+}
+
+// Loads the file again if it's changed since s was loaded, otherwise returns
+// s.
+func (s *keySet) reload() (*keySet, error) {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS file: %w", err)
+	}
+	if info.ModTime().Equal(s.modTime) {
+		return s, nil
+	}
+	return loadKeySet(s.path)
+}
+
+// The key with kid for a token signed with alg. Tokens without a kid are only
+// accepted when there's a single key it could be.
+func (s *keySet) find(kid, alg string) (crypto.PublicKey, error) {
+	k, ok := s.keys[kid]
+	if !ok && kid == "" && len(s.keys) == 1 {
+		for _, only := range s.keys {
+			k, ok = only, true
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w: kid %q", errUnknownKey, kid)
+	}
+	if k.Alg != "" && k.Alg != alg {
+		return nil, fmt.Errorf("key %q is for %s, not %s", kid, k.Alg, alg)
+	}
+	return k.public, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("n: %w", err)
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("e: %w", err)
+		}
+		if !e.IsInt64() || e.Int64() < 3 || e.Int64() > 1<<31-1 {
+			return nil, errors.New("e is out of range")
+		}
+		if n.BitLen() < 2048 {
+			return nil, fmt.Errorf("%d bit RSA keys are too small", n.BitLen())
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("x: %w", err)
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("y: %w", err)
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		// converting checks the point is actually on the curve
+		if _, err := key.ECDH(); err != nil {
+			return nil, err
+		}
+		return key, nil
+
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("x: %w", err)
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("x is the wrong size for an Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	if s == "" {
+		return nil, errors.New("missing")
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
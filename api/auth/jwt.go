@@ -0,0 +1,121 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	hmacMethods = []string{"HS256", "HS384", "HS512"}
+	jwksMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+)
+
+// What a JWTAuthenticator accepts. At least one of HMACSecret and JWKSFile
+// has to be set.
+type JWTOptions struct {
+	// Shared secret for tokens signed with HS256, HS384 or HS512.
+	HMACSecret []byte
+	// JSON Web Key Set with the public keys for tokens signed with RSA, ECDSA
+	// or Ed25519, such as an identity provider's jwks_uri saved to disk. It's
+	// read again when a token names a key it doesn't have, so rotated keys are
+	// picked up without a restart.
+	JWKSFile string
+
+	// Required iss and aud claims, if set.
+	Issuer   string
+	Audience string
+	// Clock skew allowed when checking exp, nbf and iat.
+	Leeway time.Duration
+}
+
+// Authenticates callers with JWTs, whose sub claim becomes the principal's
+// Subject. Tokens must expire.
+type JWTAuthenticator struct {
+	opts   JWTOptions
+	parser *jwt.Parser
+
+	mu   sync.Mutex
+	jwks *keySet
+}
+
+func NewJWTAuthenticator(opts JWTOptions) (*JWTAuthenticator, error) {
+	if len(opts.HMACSecret) == 0 && opts.JWKSFile == "" {
+		return nil, errors.New("auth: an HMAC secret or a JWKS file is required")
+	}
+
+	var methods []string
+	if len(opts.HMACSecret) > 0 {
+		methods = append(methods, hmacMethods...)
+	}
+	if opts.JWKSFile != "" {
+		methods = append(methods, jwksMethods...)
+	}
+
+	parserOpts := []jwt.ParserOption{
+		jwt.WithValidMethods(methods),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(opts.Leeway),
+	}
+	if opts.Issuer != "" {
+		parserOpts = append(parserOpts, jwt.WithIssuer(opts.Issuer))
+	}
+	if opts.Audience != "" {
+		parserOpts = append(parserOpts, jwt.WithAudience(opts.Audience))
+	}
+
+	a := &JWTAuthenticator{opts: opts, parser: jwt.NewParser(parserOpts...)}
+
+	// fail at startup rather than on the first request
+	if opts.JWKSFile != "" {
+		jwks, err := loadKeySet(opts.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		a.jwks = jwks
+	}
+	return a, nil
+}
+
+func (a *JWTAuthenticator) Authenticate(ctx context.Context, token string) (*Principal, error) {
+	var claims jwt.RegisteredClaims
+	if _, err := a.parser.ParseWithClaims(token, &claims, a.key); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCredentials, err)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: token has no sub claim", ErrInvalidCredentials)
+	}
+	return &Principal{Subject: claims.Subject}, nil
+}
+
+// Picks the key to verify t with. The parser has already checked that t's alg
+// is one of the methods we accept, so an HMAC token can never be checked
+// against a public key or the other way round.
+func (a *JWTAuthenticator) key(t *jwt.Token) (any, error) {
+	if _, ok := t.Method.(*jwt.SigningMethodHMAC); ok {
+		return a.opts.HMACSecret, nil
+	}
+
+	kid, _ := t.Header["kid"].(string)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	key, err := a.jwks.find(kid, t.Method.Alg())
+	if !errors.Is(err, errUnknownKey) {
+		return key, err
+	}
+
+	// the provider may have rotated its keys since we last looked
+	jwks, reloadErr := a.jwks.reload()
+	if reloadErr != nil {
+		return nil, fmt.Errorf("%w, and reloading the key set failed: %w", err, reloadErr)
+	}
+	a.jwks = jwks
+	return a.jwks.find(kid, t.Method.Alg())
+}
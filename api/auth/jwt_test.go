@@ -0,0 +1,215 @@
+package auth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var testSecret = []byte("0123456789abcdef0123456789abcdef")
+
+func sign(t *testing.T, method jwt.SigningMethod, key any, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// Claims for alice which expire in an hour, with any overrides.
+func claims(overrides jwt.MapClaims) jwt.MapClaims {
+	c := jwt.MapClaims{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix()}
+	for k, v := range overrides {
+		if v == nil {
+			delete(c, k)
+		} else {
+			c[k] = v
+		}
+	}
+	return c
+}
+
+func writeJWKS(t *testing.T, path string, keys ...map[string]string) {
+	t.Helper()
+	b, err := json.Marshal(map[string]any{"keys": keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, b, 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func rsaJWK(kid string, key *rsa.PrivateKey) map[string]string {
+	return map[string]string{
+		"kty": "RSA",
+		"kid": kid,
+		"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func TestHMAC(t *testing.T) {
+	a, err := NewJWTAuthenticator(JWTOptions{HMACSecret: testSecret, Issuer: "counters"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{name: "valid", token: sign(t, jwt.SigningMethodHS256, testSecret, "", claims(jwt.MapClaims{"iss": "counters"}))},
+		{name: "HS512", token: sign(t, jwt.SigningMethodHS512, testSecret, "", claims(jwt.MapClaims{"iss": "counters"}))},
+		{name: "wrong secret", token: sign(t, jwt.SigningMethodHS256, []byte("not the secret, not the secret!!"), "", claims(jwt.MapClaims{"iss": "counters"})), wantErr: true},
+		{name: "expired", token: sign(t, jwt.SigningMethodHS256, testSecret, "", claims(jwt.MapClaims{"iss": "counters", "exp": time.Now().Add(-time.Minute).Unix()})), wantErr: true},
+		{name: "never expires", token: sign(t, jwt.SigningMethodHS256, testSecret, "", claims(jwt.MapClaims{"iss": "counters", "exp": nil})), wantErr: true},
+		{name: "no subject", token: sign(t, jwt.SigningMethodHS256, testSecret, "", claims(jwt.MapClaims{"iss": "counters", "sub": nil})), wantErr: true},
+		{name: "wrong issuer", token: sign(t, jwt.SigningMethodHS256, testSecret, "", claims(jwt.MapClaims{"iss": "someone else"})), wantErr: true},
+		{name: "unsigned", token: sign(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, "", claims(jwt.MapClaims{"iss": "counters"})), wantErr: true},
+		{name: "garbage", token: "not.a.token", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := a.Authenticate(context.Background(), tt.token)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidCredentials) {
+					t.Fatalf("Authenticate returned %v, %v, want ErrInvalidCredentials", p, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Subject != "alice" {
+				t.Errorf("subject = %q, want alice", p.Subject)
+			}
+		})
+	}
+}
+
+func TestJWKS(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPublic, edPrivate, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path,
+		rsaJWK("rsa-1", rsaKey),
+		map[string]string{"kty": "OKP", "crv": "Ed25519", "kid": "ed-1", "x": base64.RawURLEncoding.EncodeToString(edPublic)},
+	)
+
+	a, err := NewJWTAuthenticator(JWTOptions{JWKSFile: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{name: "RSA", token: sign(t, jwt.SigningMethodRS256, rsaKey, "rsa-1", claims(nil))},
+		{name: "Ed25519", token: sign(t, jwt.SigningMethodEdDSA, edPrivate, "ed-1", claims(nil))},
+		{name: "wrong key for kid", token: sign(t, jwt.SigningMethodEdDSA, edPrivate, "rsa-1", claims(nil)), wantErr: true},
+		{name: "unknown kid", token: sign(t, jwt.SigningMethodRS256, rsaKey, "rsa-2", claims(nil)), wantErr: true},
+		{name: "no kid with several keys", token: sign(t, jwt.SigningMethodRS256, rsaKey, "", claims(nil)), wantErr: true},
+		// the public key is no secret, so it mustn't be usable as an HMAC one
+		{name: "HMAC without a secret", token: sign(t, jwt.SigningMethodHS256, testSecret, "rsa-1", claims(nil)), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := a.Authenticate(context.Background(), tt.token)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("Authenticate returned %v, want error: %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestJWKSRotation(t *testing.T) {
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, rsaJWK("old", oldKey))
+
+	a, err := NewJWTAuthenticator(JWTOptions{JWKSFile: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newToken := sign(t, jwt.SigningMethodRS256, newKey, "new", claims(nil))
+	if _, err := a.Authenticate(context.Background(), newToken); err == nil {
+		t.Fatal("token signed with a key that isn't in the file yet was accepted")
+	}
+
+	writeJWKS(t, path, rsaJWK("old", oldKey), rsaJWK("new", newKey))
+	// make sure the modification time changes, whatever the filesystem's
+	// resolution
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := a.Authenticate(context.Background(), newToken); err != nil {
+		t.Fatalf("token signed with a rotated in key was rejected: %v", err)
+	}
+}
+
+func TestBadJWKS(t *testing.T) {
+	small, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		keys []map[string]string
+	}{
+		{name: "empty"},
+		{name: "small RSA key", keys: []map[string]string{rsaJWK("small", small)}},
+		{name: "unknown type", keys: []map[string]string{{"kty": "oct", "k": "c2VjcmV0"}}},
+		{name: "point off the curve", keys: []map[string]string{{"kty": "EC", "crv": "P-256", "x": "AQ", "y": "AQ"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "jwks.json")
+			writeJWKS(t, path, tt.keys...)
+			if _, err := NewJWTAuthenticator(JWTOptions{JWKSFile: path}); err == nil {
+				t.Error("NewJWTAuthenticator accepted the key set")
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+// Package cache keeps counters and events in front of a store, either in Redis
+// or in the process's own memory, and has the tools for rebuilding and
+// checking the Redis cache against postgres.
+package cache
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/protobuf/proto"
+)
+
+// A read-through cache in front of a store, keyed by prefix and ID, where the
+// ID comes from OwnerKey. Handlers treat every error as a miss, the store is
+// always the source of truth.
+type Cache interface {
+	Get(ctx context.Context, keyPrefix, id string, message proto.Message) error
+	Set(ctx context.Context, keyPrefix, id string, message proto.Message, expiration time.Duration) error
+	Del(ctx context.Context, keyPrefix, id string) error
+}
+
+// Returned by LocalCache.Get for keys it doesn't have.
+var ErrMiss = errors.New("cache miss")
+
+// OwnerKey is the ID to cache something belonging to owner under, so an entry
+// can only be found by the user it belongs to, whichever IDs they ask for. The
+// owner is escaped so it can't contain the ":" which ends it.
+func OwnerKey(owner, id string) string {
+	return url.QueryEscape(owner) + ":" + id
+}
+
+// SplitOwnerKey reverses OwnerKey. ok is false for keys cached before entries
+// had owners, which have no owner part.
+func SplitOwnerKey(key string) (owner, id string, ok bool) {
+	escaped, id, ok := strings.Cut(key, ":")
+	if !ok {
+		return "", "", false
+	}
+	owner, err := url.QueryUnescape(escaped)
+	if err != nil {
+		return "", "", false
+	}
+	return owner, id, true
+}
+
+// Registered with the default prometheus registry, like the server's metrics.
+var cacheOperations = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "counters_cache_operations_total",
+	Help: "Redis cache operations by key prefix, operation (get, set, del) and result (hit, miss, ok, error).",
+}, []string{"prefix", "operation", "result"})
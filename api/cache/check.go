@@ -0,0 +1,217 @@
+package cache
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"github.com/alextebbs/counters/internal/telemetry"
+	pbadmin "github.com/alextebbs/counters/pb/admin/v1"
+	pbcounter "github.com/alextebbs/counters/pb/counter/v1"
+	pbevent "github.com/alextebbs/counters/pb/event/v1"
+	"github.com/alextebbs/counters/store"
+	"github.com/go-redis/redis/v8"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Compares the counter:* and event:* entries in Redis with the rows in
+// postgres they were cached from. Increment commits to postgres before it
+// writes to Redis, so if the Redis write fails the cached counter is left
+// behind with the old count.
+type Checker struct {
+	db    *sql.DB
+	redis *RedisService
+}
+
+// The outcome of a Checker.Check run.
+type CheckResult struct {
+	Checked     int64
+	Repaired    int64
+	Divergences []*pbadmin.CacheDivergence
+}
+
+func NewChecker(db *sql.DB, redis *RedisService) *Checker {
+	return &Checker{db: db, redis: redis}
+}
+
+// Check scans every cached counter and event. If repair is true, divergent
+// keys are deleted, to be cached again from postgres on their next read.
+func (c *Checker) Check(ctx context.Context, repair bool) (*CheckResult, error) {
+	result := &CheckResult{}
+
+	err := c.checkPrefix(ctx, "counter", repair, result, func() proto.Message { return &pbcounter.Counter{} }, func(owner, id string) (proto.Message, error) {
+		ctx, span := telemetry.StartQuerySpan(ctx, "SELECT", "counters")
+		counter, err := store.ScanCounter(c.db.QueryRowContext(ctx, "SELECT id, title, count, timestamp, owner FROM counters WHERE id = $1 AND owner = $2", id, owner))
+		telemetry.EndSpan(span, err)
+		return counter, err
+	})
+	if err != nil {
+		return result, err
+	}
+
+	err = c.checkPrefix(ctx, "event", repair, result, func() proto.Message { return &pbevent.Event{} }, func(owner, id string) (proto.Message, error) {
+		ctx, span := telemetry.StartQuerySpan(ctx, "SELECT", "events")
+		event, err := store.ScanEvent(c.db.QueryRowContext(ctx, "SELECT id, title, duration, created_at, counter_id, owner, created_by FROM events WHERE id = $1 AND owner = $2", id, owner))
+		telemetry.EndSpan(span, err)
+		return event, err
+	})
+	if err != nil {
+		return result, err
+	}
+
+	slog.InfoContext(ctx, "Finished checking Redis cache", "checked", result.Checked, "divergences", len(result.Divergences), "repaired", result.Repaired)
+	return result, nil
+}
+
+func (c *Checker) checkPrefix(ctx context.Context, keyPrefix string, repair bool, result *CheckResult, newMessage func() proto.Message, load func(owner, id string) (proto.Message, error)) error {
+	return c.redis.Scan(ctx, keyPrefix, func(id string) error {
+		key := fmt.Sprintf("%s:%s", keyPrefix, id)
+		result.Checked++
+
+		var divergences []*pbadmin.CacheDivergence
+
+		// the handlers never read keys without an owner, so they can only go
+		owner, rowID, ok := SplitOwnerKey(id)
+		if !ok {
+			result.Divergences = append(result.Divergences, &pbadmin.CacheDivergence{
+				Key:    key,
+				Reason: "key has no owner, it was cached before counters had owners",
+			})
+			if repair {
+				c.repair(ctx, keyPrefix, id, result)
+			}
+			return nil
+		}
+
+		stored, err := loadRow(ctx, key, owner, rowID, load)
+		if err != nil {
+			return err
+		}
+
+		cached := newMessage()
+		cacheErr := c.redis.Get(ctx, keyPrefix, id, cached)
+		if errors.Is(cacheErr, redis.Nil) {
+			// deleted since the scan
+			return nil
+		}
+
+		// an Increment may have committed between the two reads and not have
+		// written to Redis yet, so only a row that stayed the same either side
+		// of reading the cache can be compared with it
+		again, err := loadRow(ctx, key, owner, rowID, load)
+		if err != nil {
+			return err
+		}
+		if !proto.Equal(stored, again) {
+			slog.DebugContext(ctx, "Skipping cache check of row being written", "key", key)
+			return nil
+		}
+
+		if cacheErr != nil {
+			divergences = append(divergences, &pbadmin.CacheDivergence{
+				Key:    key,
+				Stored: messageString(stored),
+				Reason: fmt.Sprintf("cached entry is unreadable: %v", cacheErr),
+			})
+		} else if stored == nil {
+			divergences = append(divergences, &pbadmin.CacheDivergence{
+				Key:    key,
+				Cached: messageString(cached),
+				Reason: "row no longer exists in postgres",
+			})
+		} else {
+			divergences = diffMessages(key, cached, stored)
+		}
+
+		if len(divergences) == 0 {
+			return nil
+		}
+		result.Divergences = append(result.Divergences, divergences...)
+
+		if repair {
+			c.repair(ctx, keyPrefix, id, result)
+		}
+		return nil
+	})
+}
+
+// Loads the row a key was cached from, or nil if it no longer exists.
+func loadRow(ctx context.Context, key, owner, rowID string, load func(owner, id string) (proto.Message, error)) (proto.Message, error) {
+	stored, err := load(owner, rowID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	} else if err != nil {
+		slog.ErrorContext(ctx, "Failed to load cached entry from database for cache check", "key", key, "err", err)
+		return nil, err
+	}
+	return stored, nil
+}
+
+// Deletes a divergent key rather than rewriting it, since the row may have
+// changed again since it was read, and a rewrite could put back an older count
+// over a newer one. The next read caches it again from postgres.
+func (c *Checker) repair(ctx context.Context, keyPrefix, id string, result *CheckResult) {
+	if err := c.redis.Del(ctx, keyPrefix, id); err != nil {
+		slog.ErrorContext(ctx, "Failed to repair cached entry in Redis", "key", fmt.Sprintf("%s:%s", keyPrefix, id), "err", err)
+		return
+	}
+	result.Repaired++
+}
+
+// Compare each top level field of two messages of the same type.
+func diffMessages(key string, cached, stored proto.Message) []*pbadmin.CacheDivergence {
+	var divergences []*pbadmin.CacheDivergence
+
+	cm, sm := cached.ProtoReflect(), stored.ProtoReflect()
+	fields := sm.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if fieldsEqual(fd, cm, sm) {
+			continue
+		}
+		divergences = append(divergences, &pbadmin.CacheDivergence{
+			Key:    key,
+			Field:  string(fd.Name()),
+			Cached: fieldString(fd, cm),
+			Stored: fieldString(fd, sm),
+			Reason: "field differs",
+		})
+	}
+
+	return divergences
+}
+
+func fieldsEqual(fd protoreflect.FieldDescriptor, a, b protoreflect.Message) bool {
+	if a.Has(fd) != b.Has(fd) {
+		return false
+	}
+	if fd.Message() != nil {
+		return proto.Equal(a.Get(fd).Message().Interface(), b.Get(fd).Message().Interface())
+	}
+	return a.Get(fd).Equal(b.Get(fd))
+}
+
+func fieldString(fd protoreflect.FieldDescriptor, m protoreflect.Message) string {
+	if !m.Has(fd) {
+		return ""
+	}
+	if fd.Message() != nil {
+		return messageString(m.Get(fd).Message().Interface())
+	}
+	return m.Get(fd).String()
+}
+
+func messageString(m proto.Message) string {
+	if m == nil {
+		return ""
+	}
+	b, err := protojson.Marshal(m)
+	if err != nil {
+		return fmt.Sprintf("%v", m)
+	}
+	return string(b)
+}
@@ -0,0 +1,129 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	pbcounter "github.com/alextebbs/counters/pb/counter/v1"
+	"github.com/go-redis/redis/v8"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestCheck(t *testing.T) {
+	ctx := context.Background()
+	db, s := newTestDB(t)
+	rs := newTestRedis(t)
+
+	matching, _, err := s.CreateCounter(ctx, "alice", "coffee", "first cup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale, _, err := s.CreateCounter(ctx, "alice", "tea", "first cup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rs.Set(ctx, "counter", OwnerKey("alice", matching.Id), matching, 0); err != nil {
+		t.Fatal(err)
+	}
+	// an Increment whose Redis write failed
+	if err := rs.Set(ctx, "counter", OwnerKey("alice", stale.Id), stale, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := s.IncrementCounter(ctx, stale.Id, "alice", "second cup"); err != nil {
+		t.Fatal(err)
+	}
+	// a counter that's since been deleted, and one cached before owners
+	deleted := &pbcounter.Counter{Id: "deleted", Title: "juice", Count: 1, Owner: "alice"}
+	if err := rs.Set(ctx, "counter", OwnerKey("alice", deleted.Id), deleted, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := rs.Set(ctx, "counter", matching.Id, matching, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	checker := NewChecker(db, rs)
+	result, err := checker.Check(ctx, false)
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	if result.Repaired != 0 {
+		t.Errorf("repaired %d keys without being asked to", result.Repaired)
+	}
+	// the fields each key was reported for
+	divergent := map[string][]string{}
+	for _, d := range result.Divergences {
+		divergent[d.Key] = append(divergent[d.Key], d.Field)
+	}
+	want := map[string]string{
+		"counter:" + OwnerKey("alice", stale.Id):   "count",
+		"counter:" + OwnerKey("alice", deleted.Id): "",
+		"counter:" + matching.Id:                   "",
+	}
+	for key, field := range want {
+		got, ok := divergent[key]
+		if !ok {
+			t.Errorf("%s wasn't reported", key)
+		} else if !slices.Contains(got, field) {
+			t.Errorf("%s was reported for fields %q, want %q", key, got, field)
+		}
+	}
+	if _, ok := divergent["counter:"+OwnerKey("alice", matching.Id)]; ok {
+		t.Errorf("matching entry was reported: %v", result.Divergences)
+	}
+
+	result, err = checker.Check(ctx, true)
+	if err != nil {
+		t.Fatalf("Check with repair: %v", err)
+	}
+	if result.Repaired != 3 {
+		t.Errorf("repaired %d keys, want 3", result.Repaired)
+	}
+	for key := range want {
+		err := rs.client.Get(ctx, key).Err()
+		if !errors.Is(err, redis.Nil) {
+			t.Errorf("%s wasn't deleted: %v", key, err)
+		}
+	}
+	var got pbcounter.Counter
+	if err := rs.Get(ctx, "counter", OwnerKey("alice", matching.Id), &got); err != nil {
+		t.Errorf("matching entry was deleted: %v", err)
+	} else if !proto.Equal(&got, matching) {
+		t.Errorf("matching entry is now %v, want %v", &got, matching)
+	}
+
+	result, err = checker.Check(ctx, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Divergences) != 0 {
+		t.Errorf("still divergent after repair: %v", result.Divergences)
+	}
+}
+
+// A load that sees a different row each time, as if an Increment was
+// committing while the check ran.
+func TestCheckSkipsRowsBeingWritten(t *testing.T) {
+	ctx := context.Background()
+	rs := newTestRedis(t)
+	checker := NewChecker(nil, rs)
+
+	cached := &pbcounter.Counter{Id: "coffee", Title: "coffee", Count: 5, Owner: "alice"}
+	if err := rs.Set(ctx, "counter", OwnerKey("alice", cached.Id), cached, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	var count int32
+	result := &CheckResult{}
+	err := checker.checkPrefix(ctx, "counter", true, result, func() proto.Message { return &pbcounter.Counter{} }, func(owner, id string) (proto.Message, error) {
+		count++
+		return &pbcounter.Counter{Id: id, Title: "coffee", Count: count, Owner: owner}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Divergences) != 0 || result.Repaired != 0 {
+		t.Errorf("row being written was reported as %v and %d repaired", result.Divergences, result.Repaired)
+	}
+}
@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// A Cache kept in the server's own memory, for running without Redis. Like
+// RedisService it stores marshalled messages, so callers get their own copy.
+type LocalCache struct {
+	mu      sync.RWMutex
+	entries map[string]localCacheEntry
+	now     func() time.Time
+}
+
+type localCacheEntry struct {
+	value   []byte
+	expires time.Time // zero for never
+}
+
+func NewLocalCache() *LocalCache {
+	return &LocalCache{entries: map[string]localCacheEntry{}, now: time.Now}
+}
+
+func (c *LocalCache) Get(ctx context.Context, keyPrefix, id string, message proto.Message) error {
+	key := fmt.Sprintf("%s:%s", keyPrefix, id)
+
+	c.mu.RLock()
+	entry, ok := c.entries[key]
+	c.mu.RUnlock()
+
+	if !ok || (!entry.expires.IsZero() && c.now().After(entry.expires)) {
+		cacheOperations.WithLabelValues(keyPrefix, "get", "miss").Inc()
+		return ErrMiss
+	}
+
+	cacheOperations.WithLabelValues(keyPrefix, "get", "hit").Inc()
+	return proto.Unmarshal(entry.value, message)
+}
+
+func (c *LocalCache) Set(ctx context.Context, keyPrefix, id string, message proto.Message, expiration time.Duration) error {
+	value, err := proto.Marshal(message)
+	if err != nil {
+		cacheOperations.WithLabelValues(keyPrefix, "set", "error").Inc()
+		return err
+	}
+
+	entry := localCacheEntry{value: value}
+	if expiration > 0 {
+		entry.expires = c.now().Add(expiration)
+	}
+
+	c.mu.Lock()
+	c.entries[fmt.Sprintf("%s:%s", keyPrefix, id)] = entry
+	c.mu.Unlock()
+
+	cacheOperations.WithLabelValues(keyPrefix, "set", "ok").Inc()
+	return nil
+}
+
+func (c *LocalCache) Del(ctx context.Context, keyPrefix, id string) error {
+	c.mu.Lock()
+	delete(c.entries, fmt.Sprintf("%s:%s", keyPrefix, id))
+	c.mu.Unlock()
+
+	cacheOperations.WithLabelValues(keyPrefix, "del", "ok").Inc()
+	return nil
+}
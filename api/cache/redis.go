@@ -0,0 +1,201 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/alextebbs/counters/internal/telemetry"
+	"github.com/go-redis/redis/v8"
+	"go.opentelemetry.io/otel/attribute"
+	"google.golang.org/protobuf/proto"
+)
+
+// Wraps a redis client with some convenience methods for marshalling and
+// unmarshalling protobuf messages during cache storage and retrieval.
+type RedisService struct {
+	client *redis.Client
+}
+
+func NewRedisService(client *redis.Client) *RedisService {
+	return &RedisService{client: client}
+}
+
+// Cache a protobuf message in Redis.
+func (rs *RedisService) Set(ctx context.Context, keyPrefix, id string, message proto.Message, expiration time.Duration) error {
+	data, err := proto.Marshal(message)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to serialize data for Redis caching", "err", err)
+		return err
+	}
+
+	redisKey := fmt.Sprintf("%s:%s", keyPrefix, id)
+	ctx, span := telemetry.StartCacheSpan(ctx, "SET", redisKey)
+	err = rs.client.Set(ctx, redisKey, data, expiration).Err()
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		cacheOperations.WithLabelValues(keyPrefix, "set", "error").Inc()
+		slog.ErrorContext(ctx, "Failed to store data in Redis", "key", redisKey, "err", err)
+		return err
+	}
+	cacheOperations.WithLabelValues(keyPrefix, "set", "ok").Inc()
+
+	slog.DebugContext(ctx, "Cached data in Redis", "key", redisKey)
+	return nil
+}
+
+// Cache a batch of protobuf messages in Redis using a single pipeline, keyed by
+// id, leaving any which are already cached alone. Those were written by a
+// handler, which always has the newer copy. Returns the number of keys written.
+func (rs *RedisService) SetManyNX(ctx context.Context, keyPrefix string, messages map[string]proto.Message, expiration time.Duration) (int, error) {
+	pipe := rs.client.Pipeline()
+
+	cmds := make([]*redis.BoolCmd, 0, len(messages))
+	for id, message := range messages {
+		data, err := proto.Marshal(message)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to serialize data for Redis caching", "err", err)
+			return 0, err
+		}
+		cmds = append(cmds, pipe.SetNX(ctx, fmt.Sprintf("%s:%s", keyPrefix, id), data, expiration))
+	}
+
+	ctx, span := telemetry.StartCacheSpan(ctx, "SETNX", keyPrefix+":*")
+	span.SetAttributes(attribute.Int("db.redis.batch_size", len(messages)))
+	_, err := pipe.Exec(ctx)
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		cacheOperations.WithLabelValues(keyPrefix, "set", "error").Add(float64(len(messages)))
+		slog.ErrorContext(ctx, "Failed to store batch in Redis", "prefix", keyPrefix, "keys", len(messages), "err", err)
+		return 0, err
+	}
+
+	var written int
+	for _, cmd := range cmds {
+		if cmd.Val() {
+			written++
+		}
+	}
+	cacheOperations.WithLabelValues(keyPrefix, "set", "ok").Add(float64(written))
+
+	return written, nil
+}
+
+// Get a protobuf message from Redis.
+func (rs *RedisService) Get(ctx context.Context, keyPrefix, id string, message proto.Message) error {
+	redisKey := fmt.Sprintf("%s:%s", keyPrefix, id)
+	ctx, span := telemetry.StartCacheSpan(ctx, "GET", redisKey)
+	data, err := rs.client.Get(ctx, redisKey).Bytes()
+	span.SetAttributes(attribute.Bool("cache.hit", err == nil))
+	telemetry.EndSpan(span, err)
+
+	if err != nil {
+		if err == redis.Nil {
+			cacheOperations.WithLabelValues(keyPrefix, "get", "miss").Inc()
+			slog.DebugContext(ctx, "Item not found in Redis", "key", redisKey)
+			return err
+		}
+		cacheOperations.WithLabelValues(keyPrefix, "get", "error").Inc()
+		slog.ErrorContext(ctx, "Failed to retrieve data from Redis", "key", redisKey, "err", err)
+		return err
+	}
+
+	if err := proto.Unmarshal(data, message); err != nil {
+		cacheOperations.WithLabelValues(keyPrefix, "get", "error").Inc()
+		slog.ErrorContext(ctx, "Failed to unmarshal protobuf data from Redis", "key", redisKey, "err", err)
+		return err
+	}
+	cacheOperations.WithLabelValues(keyPrefix, "get", "hit").Inc()
+
+	slog.DebugContext(ctx, "Retrieved data from Redis", "key", redisKey)
+	return nil
+}
+
+// Get a batch of protobuf messages from Redis with a single MGET. Ids which
+// aren't cached are left out of the returned map.
+func (rs *RedisService) GetMany(ctx context.Context, keyPrefix string, ids []string, newMessage func() proto.Message) (map[string]proto.Message, error) {
+	if len(ids) == 0 {
+		return map[string]proto.Message{}, nil
+	}
+
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = fmt.Sprintf("%s:%s", keyPrefix, id)
+	}
+
+	ctx, span := telemetry.StartCacheSpan(ctx, "MGET", keyPrefix+":*")
+	span.SetAttributes(attribute.Int("db.redis.batch_size", len(keys)))
+	values, err := rs.client.MGet(ctx, keys...).Result()
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		cacheOperations.WithLabelValues(keyPrefix, "get", "error").Add(float64(len(ids)))
+		slog.ErrorContext(ctx, "Failed to retrieve batch from Redis", "prefix", keyPrefix, "keys", len(ids), "err", err)
+		return nil, err
+	}
+
+	messages := make(map[string]proto.Message, len(ids))
+	for i, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			cacheOperations.WithLabelValues(keyPrefix, "get", "miss").Inc()
+			continue
+		}
+
+		message := newMessage()
+		if err := proto.Unmarshal([]byte(data), message); err != nil {
+			cacheOperations.WithLabelValues(keyPrefix, "get", "error").Inc()
+			slog.ErrorContext(ctx, "Failed to unmarshal protobuf data from Redis", "key", keys[i], "err", err)
+			continue
+		}
+		cacheOperations.WithLabelValues(keyPrefix, "get", "hit").Inc()
+		messages[ids[i]] = message
+	}
+
+	return messages, nil
+}
+
+// Delete something from redis
+func (rs *RedisService) Del(ctx context.Context, keyPrefix, id string) error {
+	redisKey := fmt.Sprintf("%s:%s", keyPrefix, id)
+
+	ctx, span := telemetry.StartCacheSpan(ctx, "DEL", redisKey)
+	_, err := rs.client.Del(ctx, redisKey).Result()
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		cacheOperations.WithLabelValues(keyPrefix, "del", "error").Inc()
+		slog.ErrorContext(ctx, "Failed to delete key from Redis", "key", redisKey, "err", err)
+		return err
+	}
+	cacheOperations.WithLabelValues(keyPrefix, "del", "ok").Inc()
+
+	return nil
+}
+
+// Call fn with the id of every key in Redis which starts with keyPrefix.
+func (rs *RedisService) Scan(ctx context.Context, keyPrefix string, fn func(id string) error) error {
+	iter := rs.client.Scan(ctx, 0, keyPrefix+":*", 0).Iterator()
+	for iter.Next(ctx) {
+		if err := fn(strings.TrimPrefix(iter.Val(), keyPrefix+":")); err != nil {
+			return err
+		}
+	}
+
+	if err := iter.Err(); err != nil {
+		slog.ErrorContext(ctx, "Failed to scan Redis keys", "prefix", keyPrefix, "err", err)
+		return err
+	}
+
+	return nil
+}
+
+// Check that Redis is reachable.
+func (rs *RedisService) Ping(ctx context.Context) error {
+	return rs.client.Ping(ctx).Err()
+}
+
+// Close the underlying redis client.
+func (rs *RedisService) Close() error {
+	return rs.client.Close()
+}
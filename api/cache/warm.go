@@ -0,0 +1,201 @@
+package cache
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"sync"
+
+	"github.com/alextebbs/counters/internal/telemetry"
+	"github.com/alextebbs/counters/store"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	DefaultWarmBatchSize   = 500
+	DefaultWarmConcurrency = 4
+)
+
+// Rebuilds the counter:* and event:* keys in Redis from the rows in postgres.
+// After a flush or failover every List call would otherwise miss the cache for
+// every single row. Only missing keys are filled in, so it's safe to warm while
+// the handlers are writing newer copies.
+type Warmer struct {
+	db          *sql.DB
+	redis       *RedisService
+	batchSize   int
+	concurrency int
+}
+
+// How many keys have been written so far during a warm-up, not counting the
+// ones which were already cached.
+type WarmProgress struct {
+	Counters int64
+	Events   int64
+}
+
+func NewWarmer(db *sql.DB, redis *RedisService, batchSize, concurrency int) *Warmer {
+	if batchSize <= 0 {
+		batchSize = DefaultWarmBatchSize
+	}
+	if concurrency <= 0 {
+		concurrency = DefaultWarmConcurrency
+	}
+	return &Warmer{db: db, redis: redis, batchSize: batchSize, concurrency: concurrency}
+}
+
+// With returns a copy of w using a different batch size or concurrency, where
+// they're above 0.
+func (w *Warmer) With(batchSize, concurrency int) *Warmer {
+	c := *w
+	if batchSize > 0 {
+		c.batchSize = batchSize
+	}
+	if concurrency > 0 {
+		c.concurrency = concurrency
+	}
+	return &c
+}
+
+// Warm streams every counter and then every event out of postgres, writing
+// them to Redis one batch at a time with at most w.concurrency batches in
+// flight. progress, if not nil, is called after each batch is written. Calls to
+// progress never overlap.
+func (w *Warmer) Warm(ctx context.Context, progress func(WarmProgress)) (WarmProgress, error) {
+	var mu sync.Mutex
+	var p WarmProgress
+
+	report := func(counters, events int) {
+		mu.Lock()
+		defer mu.Unlock()
+		p.Counters += int64(counters)
+		p.Events += int64(events)
+		if progress != nil {
+			progress(p)
+		}
+	}
+
+	err := w.warmTable(ctx, "counter", w.scanCounters, func(n int) { report(n, 0) })
+	if err != nil {
+		return p, err
+	}
+
+	err = w.warmTable(ctx, "event", w.scanEvents, func(n int) { report(0, n) })
+	if err != nil {
+		return p, err
+	}
+
+	slog.InfoContext(ctx, "Finished warming Redis cache", "counters", p.Counters, "events", p.Events)
+	return p, nil
+}
+
+// Reads rows with scan, groups them into batches and hands the batches off to
+// a pool of workers which write them to Redis.
+func (w *Warmer) warmTable(ctx context.Context, keyPrefix string, scan func(context.Context, func(string, proto.Message) error) error, written func(int)) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	batches := make(chan map[string]proto.Message)
+
+	var wg sync.WaitGroup
+	var errOnce sync.Once
+	var workerErr error
+
+	for i := 0; i < w.concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range batches {
+				n, err := w.redis.SetManyNX(ctx, keyPrefix, batch, 0)
+				if err != nil {
+					errOnce.Do(func() {
+						workerErr = err
+						cancel()
+					})
+					continue
+				}
+				written(n)
+			}
+		}()
+	}
+
+	batch := make(map[string]proto.Message, w.batchSize)
+	send := func() error {
+		select {
+		case batches <- batch:
+			batch = make(map[string]proto.Message, w.batchSize)
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	err := scan(ctx, func(id string, message proto.Message) error {
+		batch[id] = message
+		if len(batch) < w.batchSize {
+			return nil
+		}
+		return send()
+	})
+	if err == nil && len(batch) > 0 {
+		err = send()
+	}
+
+	close(batches)
+	wg.Wait()
+
+	if workerErr != nil {
+		return workerErr
+	}
+	return err
+}
+
+func (w *Warmer) scanCounters(ctx context.Context, fn func(string, proto.Message) error) error {
+	ctx, span := telemetry.StartQuerySpan(ctx, "SELECT", "counters")
+	rows, err := w.db.QueryContext(ctx, "SELECT id, title, count, timestamp, owner FROM counters")
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to query database for counters to warm", "err", err)
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		c, err := store.ScanCounter(rows)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to read counter row", "err", err)
+			return err
+		}
+
+		if err := fn(OwnerKey(c.Owner, c.Id), c); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+func (w *Warmer) scanEvents(ctx context.Context, fn func(string, proto.Message) error) error {
+	ctx, span := telemetry.StartQuerySpan(ctx, "SELECT", "events")
+	rows, err := w.db.QueryContext(ctx, "SELECT id, title, duration, created_at, counter_id, owner, created_by FROM events")
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to query database for events to warm", "err", err)
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		e, err := store.ScanEvent(rows)
+		if err != nil {
+			slog.ErrorContext(ctx, "Failed to read event row", "err", err)
+			return err
+		}
+
+		if err := fn(OwnerKey(e.Owner, e.Id), e); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
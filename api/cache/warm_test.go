@@ -0,0 +1,84 @@
+package cache
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	pbcounter "github.com/alextebbs/counters/pb/counter/v1"
+	"github.com/alextebbs/counters/store"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+// A migrated SQLite database, which the warmer's and checker's queries run
+// against as well as postgres, with a store to fill it through.
+func newTestDB(t *testing.T) (*sql.DB, store.Store) {
+	t.Helper()
+
+	db, err := store.OpenSQLite(filepath.Join(t.TempDir(), "counters.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := store.NewMigrator(db, "sqlite")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return db, store.NewSQLiteStore(db)
+}
+
+func newTestRedis(t *testing.T) *RedisService {
+	t.Helper()
+
+	mr := miniredis.RunT(t)
+	rs := NewRedisService(redis.NewClient(&redis.Options{Addr: mr.Addr()}))
+	t.Cleanup(func() { rs.Close() })
+	return rs
+}
+
+func TestWarmKeepsNewerEntries(t *testing.T) {
+	ctx := context.Background()
+	db, s := newTestDB(t)
+	rs := newTestRedis(t)
+
+	stale, _, err := s.CreateCounter(ctx, "alice", "coffee", "first cup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	missing, _, err := s.CreateCounter(ctx, "alice", "tea", "first cup")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// an Increment which committed after the warmer read its row, and cached
+	// the newer count
+	newer := &pbcounter.Counter{Id: stale.Id, Title: stale.Title, Count: 1, Timestamp: stale.Timestamp, Owner: stale.Owner}
+	if err := rs.Set(ctx, "counter", OwnerKey("alice", stale.Id), newer, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := NewWarmer(db, rs, 1, 1).Warm(ctx, nil)
+	if err != nil {
+		t.Fatalf("Warm: %v", err)
+	}
+	if p.Counters != 1 || p.Events != 2 {
+		t.Errorf("wrote %d counters and %d events, want 1 and 2", p.Counters, p.Events)
+	}
+
+	var got pbcounter.Counter
+	if err := rs.Get(ctx, "counter", OwnerKey("alice", stale.Id), &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Count != 1 {
+		t.Errorf("cached count = %d after warming, want the newer 1", got.Count)
+	}
+	if err := rs.Get(ctx, "counter", OwnerKey("alice", missing.Id), &got); err != nil {
+		t.Errorf("missing counter wasn't warmed: %v", err)
+	}
+}
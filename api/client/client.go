@@ -0,0 +1,244 @@
+// Package client calls the counters api from Go. It wraps the generated
+// CounterService and EventService clients with the things every caller
+// otherwise writes for itself: retrying reads when the server is unavailable,
+// default deadlines, and iterating over paginated lists.
+//
+//	c, err := client.Dial("counters-api:50051", client.Options{})
+//	if err != nil {
+//		return err
+//	}
+//	defer c.Close()
+//
+//	counter, _, err := c.IncrementNow(ctx, id, "Drank a coffee")
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"math/rand"
+	"time"
+
+	pbcounter "github.com/alextebbs/counters/pb/counter/v1"
+	pbevent "github.com/alextebbs/counters/pb/event/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Options for a Client. The zero value is usable, each field has a default.
+type Options struct {
+	// Deadline for each attempt at a call whose context doesn't already have
+	// one. Defaults to 10s, negative for none.
+	Timeout time.Duration
+	// How many times a call is retried after failing with Unavailable.
+	// Defaults to 3, negative for none.
+	MaxRetries int
+	// Retry Create, IncrementNow and Delete too, not only Get and the
+	// iterators. Unavailable can come after the server has committed a write,
+	// when the connection drops before the response arrives, so a retry can
+	// create a second counter or increment one twice. Only for callers who'd
+	// rather that than fail.
+	RetryWrites bool
+	// Wait before the first retry, which doubles for each one after up to
+	// MaxBackoff. Each wait is picked at random up to that, so clients which
+	// failed together don't all retry together. Default to 100ms and 5s.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Page size the iterators ask for. Defaults to 100.
+	PageSize int32
+	// Bearer token sent with every call, for servers which require one. Either
+	// a JWT or an API key from KeyService.
+	Token string
+
+	// TLS config used by Dial, which connects without TLS if it's nil.
+	TLS *tls.Config
+	// Any other options for Dial, like interceptors.
+	DialOptions []grpc.DialOption
+}
+
+func (o Options) withDefaults() Options {
+	if o.Timeout == 0 {
+		o.Timeout = 10 * time.Second
+	}
+	if o.MaxRetries == 0 {
+		o.MaxRetries = 3
+	}
+	if o.InitialBackoff <= 0 {
+		o.InitialBackoff = 100 * time.Millisecond
+	}
+	if o.MaxBackoff <= 0 {
+		o.MaxBackoff = 5 * time.Second
+	}
+	if o.PageSize <= 0 {
+		o.PageSize = 100
+	}
+	return o
+}
+
+// A connection to the api. It's safe to use from multiple goroutines.
+type Client struct {
+	conn     *grpc.ClientConn // only if Dial made it, for Close
+	counters pbcounter.CounterServiceClient
+	events   pbevent.EventServiceClient
+	opts     Options
+}
+
+// Dial connects to the api at target, a host:port or any other gRPC target.
+// The connection is made in the background, so errors from the server only
+// show up on the first call.
+func Dial(target string, opts Options) (*Client, error) {
+	creds := insecure.NewCredentials()
+	if opts.TLS != nil {
+		creds = credentials.NewTLS(opts.TLS)
+	}
+
+	dialOpts := append([]grpc.DialOption{grpc.WithTransportCredentials(creds)}, opts.DialOptions...)
+	conn, err := grpc.NewClient(target, dialOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	c := New(conn, opts)
+	c.conn = conn
+	return c, nil
+}
+
+// New makes a Client using a connection which the caller set up, and remains
+// responsible for closing. Options.TLS and DialOptions are ignored.
+func New(conn grpc.ClientConnInterface, opts Options) *Client {
+	return &Client{
+		counters: pbcounter.NewCounterServiceClient(conn),
+		events:   pbevent.NewEventServiceClient(conn),
+		opts:     opts.withDefaults(),
+	}
+}
+
+// Close closes the connection if Dial made it.
+func (c *Client) Close() error {
+	if c.conn == nil {
+		return nil
+	}
+	return c.conn.Close()
+}
+
+// Create makes a counter, along with the first event, called eventTitle.
+func (c *Client) Create(ctx context.Context, title, eventTitle string) (*pbcounter.Counter, error) {
+	var resp *pbcounter.CounterServiceCreateResponse
+	err := c.call(ctx, c.opts.RetryWrites, func(ctx context.Context) (err error) {
+		resp, err = c.counters.Create(ctx, &pbcounter.CounterServiceCreateRequest{Title: title, EventTitle: eventTitle})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Counter, nil
+}
+
+func (c *Client) Get(ctx context.Context, id string) (*pbcounter.Counter, error) {
+	var resp *pbcounter.CounterServiceGetResponse
+	err := c.call(ctx, true, func(ctx context.Context) (err error) {
+		resp, err = c.counters.Get(ctx, &pbcounter.CounterServiceGetRequest{Id: id})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Counter, nil
+}
+
+// IncrementNow increments a counter, recording an event called title at the
+// server's current time. It returns the updated counter and the new event,
+// whose duration is the time since the counter's previous event.
+func (c *Client) IncrementNow(ctx context.Context, id, title string) (*pbcounter.Counter, *pbevent.Event, error) {
+	var resp *pbcounter.CounterServiceIncrementResponse
+	err := c.call(ctx, c.opts.RetryWrites, func(ctx context.Context) (err error) {
+		resp, err = c.counters.Increment(ctx, &pbcounter.CounterServiceIncrementRequest{Id: id, Title: title})
+		return err
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp.Counter, resp.Event, nil
+}
+
+// Delete deletes a counter and all of its events.
+func (c *Client) Delete(ctx context.Context, id string) error {
+	return c.call(ctx, c.opts.RetryWrites, func(ctx context.Context) error {
+		_, err := c.counters.Delete(ctx, &pbcounter.CounterServiceDeleteRequest{Id: id})
+		return err
+	})
+}
+
+// Counters iterates over every counter, oldest first, a page at a time.
+func (c *Client) Counters(ctx context.Context) *Iterator[*pbcounter.Counter] {
+	return newIterator(ctx, func(ctx context.Context, pageToken string) ([]*pbcounter.Counter, string, error) {
+		var resp *pbcounter.CounterServiceListResponse
+		err := c.call(ctx, true, func(ctx context.Context) (err error) {
+			resp, err = c.counters.List(ctx, &pbcounter.CounterServiceListRequest{PageSize: c.opts.PageSize, PageToken: pageToken})
+			return err
+		})
+		if err != nil {
+			return nil, "", err
+		}
+		return resp.Counters, resp.NextPageToken, nil
+	})
+}
+
+// Events iterates over a counter's events, oldest first, a page at a time.
+func (c *Client) Events(ctx context.Context, counterID string) *Iterator[*pbevent.Event] {
+	return newIterator(ctx, func(ctx context.Context, pageToken string) ([]*pbevent.Event, string, error) {
+		var resp *pbevent.EventServiceListResponse
+		err := c.call(ctx, true, func(ctx context.Context) (err error) {
+			resp, err = c.events.List(ctx, &pbevent.EventServiceListRequest{Id: counterID, PageSize: c.opts.PageSize, PageToken: pageToken})
+			return err
+		})
+		if err != nil {
+			return nil, "", err
+		}
+		return resp.Events, resp.NextPageToken, nil
+	})
+}
+
+// Runs attempt until it succeeds, fails with something other than
+// Unavailable, or runs out of retries. Only calls which are safe to repeat
+// should pass retry, since Unavailable doesn't mean the server never saw the
+// request, see Options.RetryWrites.
+func (c *Client) call(ctx context.Context, retry bool, attempt func(ctx context.Context) error) error {
+	backoff := c.opts.InitialBackoff
+	for retries := 0; ; retries++ {
+		err := c.attempt(ctx, attempt)
+		if !retry || status.Code(err) != codes.Unavailable || retries >= c.opts.MaxRetries {
+			return err
+		}
+
+		wait := time.Duration(rand.Int63n(int64(backoff)) + 1)
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		}
+
+		backoff *= 2
+		if backoff > c.opts.MaxBackoff {
+			backoff = c.opts.MaxBackoff
+		}
+	}
+}
+
+// A deadline set by the caller covers every attempt, the default only covers
+// one. The token is added per attempt too, since the context it goes in
+// doesn't outlive one.
+func (c *Client) attempt(ctx context.Context, attempt func(ctx context.Context) error) error {
+	if _, ok := ctx.Deadline(); !ok && c.opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.opts.Timeout)
+		defer cancel()
+	}
+	if c.opts.Token != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+c.opts.Token)
+	}
+	return attempt(ctx)
+}
@@ -0,0 +1,210 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	pbcounter "github.com/alextebbs/counters/pb/counter/v1"
+	pbevent "github.com/alextebbs/counters/pb/event/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// A CounterService which fails with failCode for the first failures calls,
+// and has counters titled 0 to counters-1.
+type fakeCounterServer struct {
+	pbcounter.UnimplementedCounterServiceServer
+	failures int
+	failCode codes.Code
+	counters int
+
+	calls     int
+	deadlines []bool // whether each call had a deadline
+	pageSizes []int32
+}
+
+func (s *fakeCounterServer) fail(ctx context.Context) error {
+	s.calls++
+	_, ok := ctx.Deadline()
+	s.deadlines = append(s.deadlines, ok)
+	if s.calls <= s.failures {
+		return status.Error(s.failCode, "failing on purpose")
+	}
+	return nil
+}
+
+func (s *fakeCounterServer) Increment(ctx context.Context, req *pbcounter.CounterServiceIncrementRequest) (*pbcounter.CounterServiceIncrementResponse, error) {
+	if err := s.fail(ctx); err != nil {
+		return nil, err
+	}
+	return &pbcounter.CounterServiceIncrementResponse{
+		Counter: &pbcounter.Counter{Id: req.Id, Count: 1},
+		Event:   &pbevent.Event{CounterId: req.Id, Title: req.Title},
+	}, nil
+}
+
+func (s *fakeCounterServer) List(ctx context.Context, req *pbcounter.CounterServiceListRequest) (*pbcounter.CounterServiceListResponse, error) {
+	if err := s.fail(ctx); err != nil {
+		return nil, err
+	}
+	s.pageSizes = append(s.pageSizes, req.PageSize)
+
+	start := 0
+	if req.PageToken != "" {
+		start, _ = strconv.Atoi(req.PageToken)
+	}
+	end := start + int(req.PageSize)
+	if end > s.counters {
+		end = s.counters
+	}
+
+	resp := &pbcounter.CounterServiceListResponse{}
+	for i := start; i < end; i++ {
+		resp.Counters = append(resp.Counters, &pbcounter.Counter{Title: strconv.Itoa(i)})
+	}
+	if end < s.counters {
+		resp.NextPageToken = strconv.Itoa(end)
+	}
+	return resp, nil
+}
+
+func newTestClient(t *testing.T, srv *fakeCounterServer, opts Options) *Client {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	pbcounter.RegisterCounterServiceServer(s, srv)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	opts.DialOptions = append(opts.DialOptions, grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	}))
+	c, err := Dial("passthrough:///bufnet", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestRetries(t *testing.T) {
+	tests := []struct {
+		name       string
+		failures   int
+		failCode   codes.Code
+		maxRetries int
+		// leave writes alone, as callers do unless they opt in
+		noRetryWrites bool
+		wantCode      codes.Code
+		wantCalls     int
+	}{
+		{name: "no failures", wantCalls: 1},
+		{name: "retried until it works", failures: 2, failCode: codes.Unavailable, wantCalls: 3},
+		{name: "out of retries", failures: 5, failCode: codes.Unavailable, wantCode: codes.Unavailable, wantCalls: 4},
+		{name: "retries disabled", failures: 1, failCode: codes.Unavailable, maxRetries: -1, wantCode: codes.Unavailable, wantCalls: 1},
+		{name: "other errors aren't retried", failures: 1, failCode: codes.NotFound, wantCode: codes.NotFound, wantCalls: 1},
+		{name: "writes aren't retried by default", failures: 1, failCode: codes.Unavailable, noRetryWrites: true, wantCode: codes.Unavailable, wantCalls: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := &fakeCounterServer{failures: tt.failures, failCode: tt.failCode}
+			c := newTestClient(t, srv, Options{MaxRetries: tt.maxRetries, RetryWrites: !tt.noRetryWrites, InitialBackoff: time.Millisecond})
+
+			counter, event, err := c.IncrementNow(context.Background(), "coffee", "again")
+			if code := status.Code(err); code != tt.wantCode {
+				t.Fatalf("IncrementNow returned %v, want code %v", err, tt.wantCode)
+			}
+			if srv.calls != tt.wantCalls {
+				t.Errorf("server was called %d times, want %d", srv.calls, tt.wantCalls)
+			}
+			if err == nil && (counter.Id != "coffee" || event.Title != "again") {
+				t.Errorf("IncrementNow returned counter %v and event %v", counter, event)
+			}
+		})
+	}
+}
+
+func TestDefaultDeadline(t *testing.T) {
+	tests := []struct {
+		name         string
+		timeout      time.Duration
+		callDeadline bool
+		wantDeadline bool
+	}{
+		{name: "default", wantDeadline: true},
+		{name: "disabled", timeout: -1},
+		{name: "caller's deadline", timeout: -1, callDeadline: true, wantDeadline: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := &fakeCounterServer{}
+			c := newTestClient(t, srv, Options{Timeout: tt.timeout})
+
+			ctx := context.Background()
+			if tt.callDeadline {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, time.Minute)
+				defer cancel()
+			}
+
+			if _, _, err := c.IncrementNow(ctx, "coffee", "again"); err != nil {
+				t.Fatal(err)
+			}
+			if srv.deadlines[0] != tt.wantDeadline {
+				t.Errorf("call had a deadline: %v, want %v", srv.deadlines[0], tt.wantDeadline)
+			}
+		})
+	}
+}
+
+func TestCountersIterator(t *testing.T) {
+	tests := []struct {
+		name          string
+		counters      int
+		pageSize      int32
+		failures      int
+		failCode      codes.Code
+		wantPages     int
+		wantCode      codes.Code
+		wantCollected int
+	}{
+		{name: "empty", pageSize: 2, wantPages: 1},
+		{name: "one page", counters: 2, pageSize: 5, wantPages: 1, wantCollected: 2},
+		{name: "several pages", counters: 5, pageSize: 2, wantPages: 3, wantCollected: 5},
+		{name: "default page size", counters: 150, wantPages: 2, wantCollected: 150},
+		{name: "retried page", counters: 3, pageSize: 2, failures: 1, failCode: codes.Unavailable, wantPages: 2, wantCollected: 3},
+		{name: "failed page", counters: 3, pageSize: 2, failures: 1, failCode: codes.Internal, wantCode: codes.Internal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := &fakeCounterServer{counters: tt.counters, failures: tt.failures, failCode: tt.failCode}
+			c := newTestClient(t, srv, Options{PageSize: tt.pageSize, InitialBackoff: time.Millisecond})
+
+			counters, err := c.Counters(context.Background()).All()
+			if code := status.Code(err); code != tt.wantCode {
+				t.Fatalf("All returned %v, want code %v", err, tt.wantCode)
+			}
+			if len(srv.pageSizes) != tt.wantPages {
+				t.Errorf("fetched %d pages, want %d", len(srv.pageSizes), tt.wantPages)
+			}
+			if len(counters) != tt.wantCollected {
+				t.Fatalf("got %d counters, want %d", len(counters), tt.wantCollected)
+			}
+			for i, counter := range counters {
+				if counter.Title != fmt.Sprint(i) {
+					t.Errorf("counter %d is titled %q", i, counter.Title)
+				}
+			}
+		})
+	}
+}
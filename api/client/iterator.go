@@ -0,0 +1,64 @@
+package client
+
+import "context"
+
+// Iterates over a paginated list, fetching the next page when the last one
+// runs out.
+//
+//	it := c.Counters(ctx)
+//	for it.Next() {
+//		fmt.Println(it.Value().Title)
+//	}
+//	if err := it.Err(); err != nil {
+//		return err
+//	}
+type Iterator[T any] struct {
+	ctx   context.Context
+	fetch func(ctx context.Context, pageToken string) ([]T, string, error)
+
+	page      []T
+	current   T
+	pageToken string
+	started   bool
+	err       error
+}
+
+func newIterator[T any](ctx context.Context, fetch func(ctx context.Context, pageToken string) ([]T, string, error)) *Iterator[T] {
+	return &Iterator[T]{ctx: ctx, fetch: fetch}
+}
+
+// Next moves to the next value, returning false when there are none left or
+// a page couldn't be fetched, which Err reports.
+func (it *Iterator[T]) Next() bool {
+	// a page can be empty without being the last one, if everything on it was
+	// deleted while it was being fetched
+	for len(it.page) == 0 {
+		if it.err != nil || (it.started && it.pageToken == "") {
+			return false
+		}
+		it.started = true
+		it.page, it.pageToken, it.err = it.fetch(it.ctx, it.pageToken)
+	}
+
+	it.current, it.page = it.page[0], it.page[1:]
+	return true
+}
+
+// Value is the value Next moved to.
+func (it *Iterator[T]) Value() T {
+	return it.current
+}
+
+// Err is the error which stopped the iteration, if any.
+func (it *Iterator[T]) Err() error {
+	return it.err
+}
+
+// All collects the rest of the values into a slice.
+func (it *Iterator[T]) All() ([]T, error) {
+	var all []T
+	for it.Next() {
+		all = append(all, it.Value())
+	}
+	return all, it.Err()
+}
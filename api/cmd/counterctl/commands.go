@@ -0,0 +1,287 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"time"
+
+	pbcounter "github.com/alextebbs/counters/pb/counter/v1"
+	pbevent "github.com/alextebbs/counters/pb/event/v1"
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// Shared by every command, set up before each one runs.
+type cli struct {
+	cfg     *Config
+	conn    *grpc.ClientConn
+	printer *printer
+
+	counters pbcounter.CounterServiceClient
+	events   pbevent.EventServiceClient
+}
+
+func newRootCmd() *cobra.Command {
+	c := &cli{}
+
+	var (
+		configPath string
+		server     string
+		output     string
+		timeout    time.Duration
+	)
+
+	root := &cobra.Command{
+		Use:           "counterctl",
+		Short:         "Manage counters and their events",
+		SilenceUsage:  true,
+		SilenceErrors: true,
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			explicit := cmd.Flags().Changed("config") || os.Getenv("COUNTERCTL_CONFIG") != ""
+			cfg, err := loadConfig(configPath, explicit)
+			if err != nil {
+				return err
+			}
+			if cmd.Flags().Changed("server") {
+				cfg.Server = server
+			}
+			if cmd.Flags().Changed("output") {
+				cfg.Output = output
+			}
+			if cmd.Flags().Changed("timeout") {
+				cfg.Timeout = timeout
+			}
+			// not a flag, so it doesn't end up in shell history and ps
+			if token := os.Getenv("COUNTERCTL_TOKEN"); token != "" {
+				cfg.Token = token
+			}
+			if err := cfg.Validate(); err != nil {
+				return err
+			}
+
+			conn, err := cfg.Dial()
+			if err != nil {
+				return err
+			}
+
+			c.cfg = cfg
+			c.conn = conn
+			c.printer = &printer{w: cmd.OutOrStdout(), format: cfg.Output, now: time.Now}
+			c.counters = pbcounter.NewCounterServiceClient(conn)
+			c.events = pbevent.NewEventServiceClient(conn)
+			return nil
+		},
+		PersistentPostRunE: func(cmd *cobra.Command, args []string) error {
+			return c.conn.Close()
+		},
+	}
+
+	configDefault := os.Getenv("COUNTERCTL_CONFIG")
+	if configDefault == "" {
+		configDefault = defaultConfigPath()
+	}
+
+	flags := root.PersistentFlags()
+	flags.StringVar(&configPath, "config", configDefault, "config file (env COUNTERCTL_CONFIG)")
+	flags.StringVarP(&server, "server", "s", "", "host:port of the api, overrides the config file")
+	flags.StringVarP(&output, "output", "o", "", "output format: table, json or yaml, overrides the config file")
+	flags.DurationVar(&timeout, "timeout", 0, "deadline for each request, overrides the config file")
+
+	root.RegisterFlagCompletionFunc("output", cobra.FixedCompletions([]string{"table", "json", "yaml"}, cobra.ShellCompDirectiveNoFileComp))
+	root.MarkPersistentFlagFilename("config", "yaml", "yml")
+
+	root.AddCommand(
+		c.createCmd(),
+		c.listCmd(),
+		c.getCmd(),
+		c.incrementCmd(),
+		c.deleteCmd(),
+		c.eventsCmd(),
+	)
+	return root
+}
+
+// A context with the configured deadline for one RPC.
+func (c *cli) context(cmd *cobra.Command) (context.Context, context.CancelFunc) {
+	if c.cfg.Timeout == 0 {
+		return context.WithCancel(cmd.Context())
+	}
+	return context.WithTimeout(cmd.Context(), c.cfg.Timeout)
+}
+
+func (c *cli) createCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "create TITLE [EVENT_TITLE]",
+		Short: "Create a counter, along with its first event",
+		Args:  cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			eventTitle := "Created"
+			if len(args) > 1 {
+				eventTitle = args[1]
+			}
+
+			ctx, cancel := c.context(cmd)
+			defer cancel()
+
+			resp, err := c.counters.Create(ctx, &pbcounter.CounterServiceCreateRequest{Title: args[0], EventTitle: eventTitle})
+			if err != nil {
+				return err
+			}
+			return c.printCounters(resp, resp.Counter)
+		},
+		ValidArgsFunction: cobra.NoFileCompletions,
+	}
+}
+
+func (c *cli) listCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "list",
+		Short: "List every counter",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := c.context(cmd)
+			defer cancel()
+
+			resp, err := c.counters.List(ctx, &pbcounter.CounterServiceListRequest{})
+			if err != nil {
+				return err
+			}
+			return c.printCounters(resp, resp.Counters...)
+		},
+	}
+}
+
+func (c *cli) getCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "get ID",
+		Short: "Show a counter",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := c.context(cmd)
+			defer cancel()
+
+			resp, err := c.counters.Get(ctx, &pbcounter.CounterServiceGetRequest{Id: args[0]})
+			if err != nil {
+				return err
+			}
+			return c.printCounters(resp, resp.Counter)
+		},
+		ValidArgsFunction: c.completeCounterIDs,
+	}
+}
+
+func (c *cli) incrementCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "increment ID [TITLE]",
+		Short: "Increment a counter, recording an event with the time since the last one",
+		Args:  cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			title := "Incremented"
+			if len(args) > 1 {
+				title = args[1]
+			}
+
+			ctx, cancel := c.context(cmd)
+			defer cancel()
+
+			resp, err := c.counters.Increment(ctx, &pbcounter.CounterServiceIncrementRequest{Id: args[0], Title: title})
+			if err != nil {
+				return err
+			}
+			return c.printCounters(resp, resp.Counter)
+		},
+		ValidArgsFunction: c.completeCounterIDs,
+	}
+}
+
+func (c *cli) deleteCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "delete ID",
+		Short: "Delete a counter and all of its events",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := c.context(cmd)
+			defer cancel()
+
+			resp, err := c.counters.Delete(ctx, &pbcounter.CounterServiceDeleteRequest{Id: args[0]})
+			if err != nil {
+				return err
+			}
+			return c.printer.print(resp, []string{"DELETED"}, [][]string{{args[0]}})
+		},
+		ValidArgsFunction: c.completeCounterIDs,
+	}
+}
+
+func (c *cli) eventsCmd() *cobra.Command {
+	return &cobra.Command{
+		Use:   "events ID",
+		Short: "List a counter's events, oldest first",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			ctx, cancel := c.context(cmd)
+			defer cancel()
+
+			resp, err := c.events.List(ctx, &pbevent.EventServiceListRequest{Id: args[0]})
+			if err != nil {
+				return err
+			}
+
+			now := c.printer.now()
+			var rows [][]string
+			for i, e := range resp.Events {
+				// the first event has nothing before it to measure from
+				after := "-"
+				if i > 0 {
+					after = humanDuration(e.Duration.AsDuration())
+				}
+				rows = append(rows, []string{e.Id, e.Title, after, since(e.CreatedAt.AsTime(), now)})
+			}
+			return c.printer.print(resp, []string{"ID", "TITLE", "AFTER", "CREATED"}, rows)
+		},
+		ValidArgsFunction: c.completeCounterIDs,
+	}
+}
+
+func (c *cli) printCounters(resp proto.Message, counters ...*pbcounter.Counter) error {
+	now := c.printer.now()
+	var rows [][]string
+	for _, counter := range counters {
+		rows = append(rows, []string{counter.Id, counter.Title, strconv.Itoa(int(counter.Count)), since(counter.Timestamp.AsTime(), now)})
+	}
+	return c.printer.print(resp, []string{"ID", "TITLE", "COUNT", "LAST"}, rows)
+}
+
+// Completes the first argument with the IDs of every counter, described by
+// their titles.
+func (c *cli) completeCounterIDs(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+
+	// PersistentPreRunE ran for the hidden completion command, before the flags
+	// on the line being completed were parsed, so set up again with them. The
+	// new connection is closed by PersistentPostRunE as usual.
+	if c.conn != nil {
+		c.conn.Close()
+	}
+	if err := cmd.Root().PersistentPreRunE(cmd, args); err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	ctx, cancel := c.context(cmd)
+	defer cancel()
+
+	resp, err := c.counters.List(ctx, &pbcounter.CounterServiceListRequest{})
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	var ids []string
+	for _, counter := range resp.Counters {
+		ids = append(ids, counter.Id+"\t"+counter.Title)
+	}
+	return ids, cobra.ShellCompDirectiveNoFileComp
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"gopkg.in/yaml.v3"
+)
+
+// Where to find the api and how to talk to it. Flags override the config file.
+type Config struct {
+	Server  string        `yaml:"server"`  // host:port of the api's gRPC listener
+	Timeout time.Duration `yaml:"timeout"` // Deadline for each RPC
+	Output  string        `yaml:"output"`  // table, json or yaml
+	Token   string        `yaml:"token"`   // Optional: bearer token for servers with auth enabled, COUNTERCTL_TOKEN overrides it
+	TLS     TLSConfig     `yaml:"tls"`
+}
+
+type TLSConfig struct {
+	Enabled    bool   `yaml:"enabled"`
+	CAFile     string `yaml:"ca_file"`     // Optional: verify the server with this CA instead of the system roots
+	CertFile   string `yaml:"cert_file"`   // Optional: client certificate, for servers with tls.client_ca_file set
+	KeyFile    string `yaml:"key_file"`    // Optional: private key for cert_file
+	ServerName string `yaml:"server_name"` // Optional: name to verify the server's certificate against, if not the server's host
+}
+
+func defaultConfig() *Config {
+	return &Config{
+		Server:  "localhost:50051",
+		Timeout: 10 * time.Second,
+		Output:  "table",
+	}
+}
+
+// The config file used when neither -config nor COUNTERCTL_CONFIG is given,
+// usually ~/.config/counterctl/config.yaml.
+func defaultConfigPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "counterctl", "config.yaml")
+}
+
+// Reads the config file at path over the defaults. The default path doesn't
+// have to exist, but one which was asked for does.
+func loadConfig(path string, explicit bool) (*Config, error) {
+	cfg := defaultConfig()
+	if path == "" {
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && !explicit {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+func (c *Config) Validate() error {
+	switch c.Output {
+	case "table", "json", "yaml":
+	default:
+		return fmt.Errorf("unknown output format %q, expected table, json or yaml", c.Output)
+	}
+	if c.Server == "" {
+		return errors.New("server is required")
+	}
+	if c.Timeout < 0 {
+		return errors.New("timeout must not be negative")
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		return errors.New("tls: cert_file and key_file must be set together")
+	}
+	return nil
+}
+
+// The transport credentials for c, plaintext unless TLS is enabled.
+func (c *TLSConfig) Credentials() (credentials.TransportCredentials, error) {
+	if !c.Enabled {
+		return insecure.NewCredentials(), nil
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName: c.ServerName,
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", c.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if c.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client key pair: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return credentials.NewTLS(tlsConfig), nil
+}
+
+// Connects to the configured server. grpc connects lazily, so this only fails
+// when the config is broken.
+func (c *Config) Dial() (*grpc.ClientConn, error) {
+	creds, err := c.TLS.Credentials()
+	if err != nil {
+		return nil, err
+	}
+	opts := []grpc.DialOption{grpc.WithTransportCredentials(creds)}
+	if c.Token != "" {
+		opts = append(opts, grpc.WithPerRPCCredentials(bearerToken(c.Token)))
+	}
+	return grpc.NewClient(c.Server, opts...)
+}
+
+// Sends the token in the authorization metadata of every call. grpc won't
+// send credentials without TLS unless told that's fine, which it is for a
+// server on localhost or behind a proxy which terminates TLS.
+type bearerToken string
+
+func (t bearerToken) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + string(t)}, nil
+}
+
+func (t bearerToken) RequireTransportSecurity() bool {
+	return false
+}
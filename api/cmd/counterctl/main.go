@@ -0,0 +1,35 @@
+// counterctl manages counters from the command line, over the api's gRPC
+// listener.
+//
+// Usage:
+//
+//	counterctl create TITLE [EVENT_TITLE]
+//	counterctl list
+//	counterctl get ID
+//	counterctl increment ID [TITLE]
+//	counterctl delete ID
+//	counterctl events ID
+//	counterctl completion bash|zsh|fish|powershell
+//
+// The server and TLS settings come from ~/.config/counterctl/config.yaml, or
+// the file given by -config or COUNTERCTL_CONFIG. See config.example.yaml.
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"google.golang.org/grpc/status"
+)
+
+func main() {
+	if err := newRootCmd().Execute(); err != nil {
+		// show the api's message rather than the whole status
+		if s, ok := status.FromError(err); ok {
+			fmt.Fprintf(os.Stderr, "Error: %s: %s\n", s.Code(), s.Message())
+		} else {
+			fmt.Fprintln(os.Stderr, "Error:", err)
+		}
+		os.Exit(1)
+	}
+}
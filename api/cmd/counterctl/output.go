@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"gopkg.in/yaml.v3"
+)
+
+// Writes responses in the format picked with -output. JSON and YAML are the
+// whole response message, as the api's JSON routes would return it, so they
+// can be piped into jq or yq.
+type printer struct {
+	w      io.Writer
+	format string
+	now    func() time.Time
+}
+
+func (p *printer) message(m proto.Message) error {
+	b, err := protojson.MarshalOptions{EmitUnpopulated: true}.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	if p.format == "yaml" {
+		return writeYAML(p.w, b)
+	}
+
+	// protojson's own indentation changes randomly between builds, to stop
+	// anyone relying on it, but scripts diffing our output should be able to
+	var out bytes.Buffer
+	if err := json.Indent(&out, b, "", "  "); err != nil {
+		return err
+	}
+	out.WriteByte('\n')
+	_, err = out.WriteTo(p.w)
+	return err
+}
+
+// Prints m in the output format, with rows of the columns in header for
+// tables.
+func (p *printer) print(m proto.Message, header []string, rows [][]string) error {
+	if p.format != "table" {
+		return p.message(m)
+	}
+
+	tw := tabwriter.NewWriter(p.w, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// JSON is already YAML, so decoding it into a node keeps the field order
+// protojson used, and it only needs its flow style taking off to look like
+// YAML written by hand.
+func writeYAML(w io.Writer, jsonBytes []byte) error {
+	var node yaml.Node
+	if err := yaml.Unmarshal(jsonBytes, &node); err != nil {
+		return err
+	}
+	blockStyle(&node)
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&node); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+func blockStyle(n *yaml.Node) {
+	n.Style &^= yaml.FlowStyle
+	// JSON quotes every string, YAML only needs to when it would be ambiguous
+	if n.Kind == yaml.ScalarNode && n.Tag == "!!str" {
+		n.Style &^= yaml.DoubleQuotedStyle
+	}
+	for _, c := range n.Content {
+		blockStyle(c)
+	}
+}
+
+// How long ago t was, roughly, like "5m ago".
+func since(t, now time.Time) string {
+	d := now.Sub(t)
+	if d < time.Minute {
+		return "just now"
+	}
+	return humanDuration(d) + " ago"
+}
+
+// d in its two largest units, like "3d 4h" or "5m 10s".
+func humanDuration(d time.Duration) string {
+	if d < 0 {
+		d = -d
+	}
+	if d < time.Second {
+		return "0s"
+	}
+
+	units := []struct {
+		suffix string
+		size   time.Duration
+	}{
+		{"d", 24 * time.Hour},
+		{"h", time.Hour},
+		{"m", time.Minute},
+		{"s", time.Second},
+	}
+
+	var parts []string
+	for _, u := range units {
+		if d < u.size {
+			if len(parts) > 0 {
+				break
+			}
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%d%s", d/u.size, u.suffix))
+		d %= u.size
+		if len(parts) == 2 || d < time.Second {
+			break
+		}
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	pbcounter "github.com/alextebbs/counters/pb/counter/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestHumanDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{0, "0s"},
+		{500 * time.Millisecond, "0s"},
+		{45 * time.Second, "45s"},
+		{5*time.Minute + 10*time.Second, "5m 10s"},
+		{2 * time.Hour, "2h"},
+		{time.Hour + 5*time.Second, "1h"}, // only the two largest units, which are next to each other
+		{3*24*time.Hour + 4*time.Hour + 30*time.Minute, "3d 4h"},
+		{-90 * time.Second, "1m 30s"},
+	}
+
+	for _, tt := range tests {
+		if got := humanDuration(tt.d); got != tt.want {
+			t.Errorf("humanDuration(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestSince(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		t    time.Time
+		want string
+	}{
+		{now, "just now"},
+		{now.Add(-30 * time.Second), "just now"},
+		{now.Add(-90 * time.Minute), "1h 30m ago"},
+	}
+
+	for _, tt := range tests {
+		if got := since(tt.t, now); got != tt.want {
+			t.Errorf("since(%v) = %q, want %q", tt.t, got, tt.want)
+		}
+	}
+}
+
+func TestPrinter(t *testing.T) {
+	resp := &pbcounter.CounterServiceGetResponse{Counter: &pbcounter.Counter{
+		Id:        "f47ac10b-58cc-4372-a567-0e02b2c3d479",
+		Title:     "coffee",
+		Count:     3,
+		Timestamp: timestamppb.New(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)),
+		Owner:     "alice",
+	}}
+	header := []string{"ID", "TITLE"}
+	rows := [][]string{{resp.Counter.Id, resp.Counter.Title}}
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{"table", "ID                                     TITLE\nf47ac10b-58cc-4372-a567-0e02b2c3d479   coffee\n"},
+		{"json", "{\n  \"counter\": {\n    \"id\": \"f47ac10b-58cc-4372-a567-0e02b2c3d479\",\n    \"title\": \"coffee\",\n    \"count\": 3,\n    \"timestamp\": \"2024-01-01T00:00:00Z\",\n    \"owner\": \"alice\"\n  }\n}\n"},
+		// the timestamp stays quoted so it isn't read back as a YAML timestamp
+		{"yaml", "counter:\n  id: f47ac10b-58cc-4372-a567-0e02b2c3d479\n  title: coffee\n  count: 3\n  timestamp: \"2024-01-01T00:00:00Z\"\n  owner: alice\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var b bytes.Buffer
+			p := &printer{w: &b, format: tt.format}
+			if err := p.print(resp, header, rows); err != nil {
+				t.Fatal(err)
+			}
+			if b.String() != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", b.String(), tt.want)
+			}
+		})
+	}
+}
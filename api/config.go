@@ -0,0 +1,637 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/alextebbs/counters/cache"
+	"gopkg.in/yaml.v3"
+)
+
+// Everything the server needs to know about its environment. Values are
+// layered, each one overriding the last: defaults, then the optional YAML file
+// given by -config or COUNTERS_CONFIG, then environment variables, then flags.
+type Config struct {
+	ListenAddr      string          `yaml:"listen_addr"`
+	HTTPListenAddr  string          `yaml:"http_listen_addr"` // Optional: serves /healthz, /readyz and /metrics
+	Web             WebConfig       `yaml:"web"`
+	ShutdownTimeout time.Duration   `yaml:"shutdown_timeout"`
+	RequestTimeout  time.Duration   `yaml:"request_timeout"` // Deadline for unary RPCs which arrive without one, 0 for none
+	DrainDelay      time.Duration   `yaml:"drain_delay"`
+	Health          HealthConfig    `yaml:"health"`
+	TLS             TLSConfig       `yaml:"tls"`
+	Auth            AuthConfig      `yaml:"auth"`
+	RateLimit       RateLimitConfig `yaml:"rate_limit"`
+	Quotas          QuotaConfig     `yaml:"quotas"`
+	Storage         string          `yaml:"storage"` // postgres, or sqlite to run without postgres and Redis
+	Postgres        PostgresConfig  `yaml:"postgres"`
+	SQLite          SQLiteConfig    `yaml:"sqlite"`
+	Redis           RedisConfig     `yaml:"redis"`
+	Cache           CacheConfig     `yaml:"cache"`
+	Exporter        ExporterConfig  `yaml:"exporter"`
+	Tracing         TracingConfig   `yaml:"tracing"`
+	Logging         LoggingConfig   `yaml:"logging"`
+}
+
+// The optional listener for browsers and scripts, which serves gRPC-Web, the
+// Connect protocol and REST routes with JSON as well as gRPC.
+type WebConfig struct {
+	ListenAddr     string        `yaml:"listen_addr"`     // Empty to disable
+	AllowedOrigins []string      `yaml:"allowed_origins"` // CORS origins, "*" for any, none to only allow same-origin requests
+	CORSMaxAge     time.Duration `yaml:"cors_max_age"`    // How long browsers can cache preflight responses for
+}
+
+type HealthConfig struct {
+	ProbeInterval time.Duration `yaml:"probe_interval"`
+	ProbeTimeout  time.Duration `yaml:"probe_timeout"`
+}
+
+type TLSConfig struct {
+	CertFile     string `yaml:"cert_file"`
+	KeyFile      string `yaml:"key_file"`
+	ClientCAFile string `yaml:"client_ca_file"` // Optional: require client certificates signed by this CA
+}
+
+// Bearer token authentication, which is off unless hmac_secret or jwks_file
+// is set.
+type AuthConfig struct {
+	HMACSecret string        `yaml:"hmac_secret"` // Shared secret for HS256, HS384 and HS512 tokens
+	JWKSFile   string        `yaml:"jwks_file"`   // Public keys for RSA, ECDSA and Ed25519 tokens
+	Issuer     string        `yaml:"issuer"`      // Optional: required iss claim
+	Audience   string        `yaml:"audience"`    // Optional: required aud claim
+	Leeway     time.Duration `yaml:"leeway"`      // Clock skew allowed when checking exp, nbf and iat
+	Admins     []string      `yaml:"admins"`      // Subjects who can use AdminService, none for nobody
+}
+
+func (c *AuthConfig) Enabled() bool {
+	return c.HMACSecret != "" || c.JWKSFile != ""
+}
+
+// A token bucket for each caller and method, kept in Redis with postgres so
+// every replica shares it, or in memory with sqlite.
+type RateLimitConfig struct {
+	Rate  float64 `yaml:"rate"`  // Calls a second, 0 to disable
+	Burst int     `yaml:"burst"` // Calls allowed at once before Rate applies
+}
+
+// Limits on how much can be stored, 0 for none.
+type QuotaConfig struct {
+	MaxCountersPerUser        int `yaml:"max_counters_per_user"`
+	MaxEventsPerCounterPerDay int `yaml:"max_events_per_counter_per_day"` // UTC days
+}
+
+type PostgresConfig struct {
+	Host             string        `yaml:"host"`
+	Port             int           `yaml:"port"`
+	User             string        `yaml:"user"`
+	Password         string        `yaml:"password"`
+	DBName           string        `yaml:"dbname"`
+	SSLMode          string        `yaml:"sslmode"`
+	MaxOpenConns     int           `yaml:"max_open_conns"`
+	MaxIdleConns     int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime  time.Duration `yaml:"conn_max_lifetime"`
+	ConnMaxIdleTime  time.Duration `yaml:"conn_max_idle_time"`
+	MigrateOnStartup bool          `yaml:"migrate_on_startup"`
+}
+
+// Used instead of postgres and Redis when storage is sqlite. The schema is
+// migrated at startup and the cache lives in the server's memory.
+type SQLiteConfig struct {
+	Path string `yaml:"path"`
+}
+
+type RedisConfig struct {
+	Addr     string `yaml:"addr"`
+	Password string `yaml:"password"`
+	DB       int    `yaml:"db"`
+	PoolSize int    `yaml:"pool_size"` // 0 uses the go-redis default of 10 per CPU
+}
+
+type CacheConfig struct {
+	WarmOnStartup   bool `yaml:"warm_on_startup"`
+	WarmBatchSize   int  `yaml:"warm_batch_size"`
+	WarmConcurrency int  `yaml:"warm_concurrency"`
+}
+
+// The opt-in /metrics/counters endpoint, which publishes the counters
+// themselves as gauges.
+type ExporterConfig struct {
+	Enabled    bool          `yaml:"enabled"`
+	Tag        string        `yaml:"tag"`         // Optional: only export counters with this tag by default
+	TagRefresh time.Duration `yaml:"tag_refresh"` // How long the counters with a tag are remembered for
+	Timeout    time.Duration `yaml:"timeout"`
+}
+
+type TracingConfig struct {
+	Exporter     string  `yaml:"exporter"` // none, stdout or otlp
+	OTLPEndpoint string  `yaml:"otlp_endpoint"`
+	OTLPInsecure bool    `yaml:"otlp_insecure"`
+	ServiceName  string  `yaml:"service_name"`
+	SampleRatio  float64 `yaml:"sample_ratio"` // Only applies to traces which didn't come with a sampling decision
+}
+
+type LoggingConfig struct {
+	Level  string `yaml:"level"`  // debug, info, warn or error
+	Format string `yaml:"format"` // json or text
+}
+
+// The values used when nothing else is configured, which match the k8s
+// namespace in k8s/.
+func defaultConfig() *Config {
+	return &Config{
+		ListenAddr:     ":50051",
+		HTTPListenAddr: ":8081",
+		// k8s sends SIGKILL 30s after SIGTERM by default
+		ShutdownTimeout: 25 * time.Second,
+		RequestTimeout:  10 * time.Second,
+		Web: WebConfig{
+			CORSMaxAge: 2 * time.Hour,
+		},
+		Health: HealthConfig{
+			ProbeInterval: 5 * time.Second,
+			ProbeTimeout:  2 * time.Second,
+		},
+		Auth: AuthConfig{
+			Leeway: 30 * time.Second,
+		},
+		RateLimit: RateLimitConfig{
+			Burst: 20,
+		},
+		Storage: "postgres",
+		Postgres: PostgresConfig{
+			Host:         "postgres",
+			Port:         5432,
+			SSLMode:      "disable",
+			MaxOpenConns: 20,
+			MaxIdleConns: 5,
+		},
+		SQLite: SQLiteConfig{
+			Path: "counters.db",
+		},
+		Redis: RedisConfig{
+			Addr: "redis:6379",
+		},
+		Cache: CacheConfig{
+			WarmBatchSize:   cache.DefaultWarmBatchSize,
+			WarmConcurrency: cache.DefaultWarmConcurrency,
+		},
+		Exporter: ExporterConfig{
+			TagRefresh: time.Minute,
+			Timeout:    10 * time.Second,
+		},
+		Tracing: TracingConfig{
+			Exporter:     "none",
+			OTLPEndpoint: "localhost:4317",
+			ServiceName:  "counter-api",
+			SampleRatio:  1,
+		},
+		Logging: LoggingConfig{
+			Level:  "info",
+			Format: "json",
+		},
+	}
+}
+
+// A single configurable value, settable from an environment variable or flag.
+type setting struct {
+	flag  string
+	env   string
+	usage string
+	ptr   any // *string, *[]string, *int, *bool, *float64 or *time.Duration pointing into a Config
+}
+
+func (c *Config) settings() []setting {
+	return []setting{
+		{"listen-addr", "LISTEN_ADDR", "address the gRPC server listens on", &c.ListenAddr},
+		{"http-listen-addr", "HTTP_LISTEN_ADDR", "address the HTTP server for health checks and metrics listens on, empty to disable", &c.HTTPListenAddr},
+		{"web-listen-addr", "WEB_LISTEN_ADDR", "address the server for gRPC-Web, Connect, REST and gRPC listens on, empty to disable", &c.Web.ListenAddr},
+		{"web-allowed-origins", "WEB_ALLOWED_ORIGINS", "comma separated origins browsers can call the web listener from, * for any", &c.Web.AllowedOrigins},
+		{"web-cors-max-age", "WEB_CORS_MAX_AGE", "how long browsers can cache CORS preflight responses", &c.Web.CORSMaxAge},
+		{"shutdown-timeout", "SHUTDOWN_TIMEOUT", "how long in-flight requests get to finish after SIGTERM", &c.ShutdownTimeout},
+		{"request-timeout", "REQUEST_TIMEOUT", "deadline for unary RPCs whose client didn't set one, 0 for none", &c.RequestTimeout},
+		{"drain-delay", "DRAIN_DELAY", "how long to keep serving while reporting not ready after SIGTERM", &c.DrainDelay},
+		{"health-probe-interval", "HEALTH_PROBE_INTERVAL", "how often postgres and Redis are checked", &c.Health.ProbeInterval},
+		{"health-probe-timeout", "HEALTH_PROBE_TIMEOUT", "how long each postgres and Redis check can take", &c.Health.ProbeTimeout},
+		{"tls-cert-file", "TLS_CERT_FILE", "PEM certificate to serve TLS with", &c.TLS.CertFile},
+		{"tls-key-file", "TLS_KEY_FILE", "PEM private key for -tls-cert-file", &c.TLS.KeyFile},
+		{"tls-client-ca-file", "TLS_CLIENT_CA_FILE", "PEM CA bundle used to require and verify client certificates", &c.TLS.ClientCAFile},
+		{"auth-hmac-secret", "AUTH_HMAC_SECRET", "shared secret for HS256, HS384 and HS512 bearer tokens, at least 32 bytes", &c.Auth.HMACSecret},
+		{"auth-jwks-file", "AUTH_JWKS_FILE", "JSON Web Key Set with the public keys for RSA, ECDSA and Ed25519 bearer tokens", &c.Auth.JWKSFile},
+		{"auth-issuer", "AUTH_ISSUER", "iss claim bearer tokens must have, empty to accept any", &c.Auth.Issuer},
+		{"auth-audience", "AUTH_AUDIENCE", "aud claim bearer tokens must have, empty to accept any", &c.Auth.Audience},
+		{"auth-leeway", "AUTH_LEEWAY", "clock skew allowed when checking bearer token expiry", &c.Auth.Leeway},
+		{"auth-admins", "AUTH_ADMINS", "comma separated subjects who can call AdminService and create admin API keys, empty for nobody", &c.Auth.Admins},
+		{"rate-limit", "RATE_LIMIT", "calls a second each caller can make to each method, 0 to disable", &c.RateLimit.Rate},
+		{"rate-limit-burst", "RATE_LIMIT_BURST", "calls each caller can make to each method at once before -rate-limit applies", &c.RateLimit.Burst},
+		{"max-counters-per-user", "MAX_COUNTERS_PER_USER", "counters each user can create, 0 for no limit", &c.Quotas.MaxCountersPerUser},
+		{"max-events-per-counter-per-day", "MAX_EVENTS_PER_COUNTER_PER_DAY", "events each counter can have per UTC day, 0 for no limit", &c.Quotas.MaxEventsPerCounterPerDay},
+		{"storage", "STORAGE", "where counters are kept: postgres, or sqlite for a single binary without postgres and Redis", &c.Storage},
+		{"sqlite-path", "SQLITE_PATH", "SQLite file used when -storage is sqlite", &c.SQLite.Path},
+		{"postgres-host", "POSTGRES_HOST", "postgres host", &c.Postgres.Host},
+		{"postgres-port", "POSTGRES_PORT", "postgres port", &c.Postgres.Port},
+		{"postgres-user", "POSTGRES_USER", "postgres user", &c.Postgres.User},
+		{"postgres-password", "POSTGRES_PASSWORD", "postgres password", &c.Postgres.Password},
+		{"postgres-db", "POSTGRES_DB", "postgres database name", &c.Postgres.DBName},
+		{"postgres-sslmode", "POSTGRES_SSLMODE", "postgres sslmode: disable, require, verify-ca or verify-full", &c.Postgres.SSLMode},
+		{"postgres-max-open-conns", "POSTGRES_MAX_OPEN_CONNS", "maximum open connections in the pool, 0 for unlimited", &c.Postgres.MaxOpenConns},
+		{"postgres-max-idle-conns", "POSTGRES_MAX_IDLE_CONNS", "maximum idle connections kept in the pool", &c.Postgres.MaxIdleConns},
+		{"postgres-conn-max-lifetime", "POSTGRES_CONN_MAX_LIFETIME", "close connections after they have been open this long, 0 to keep them forever", &c.Postgres.ConnMaxLifetime},
+		{"postgres-conn-max-idle-time", "POSTGRES_CONN_MAX_IDLE_TIME", "close connections after they have been idle this long, 0 to keep them forever", &c.Postgres.ConnMaxIdleTime},
+		{"migrate", "POSTGRES_MIGRATE_ON_STARTUP", "apply pending database migrations before serving", &c.Postgres.MigrateOnStartup},
+		{"redis-addr", "REDIS_ADDR", "redis host:port", &c.Redis.Addr},
+		{"redis-password", "REDIS_PASSWORD", "redis password", &c.Redis.Password},
+		{"redis-db", "REDIS_DB", "redis database number", &c.Redis.DB},
+		{"redis-pool-size", "REDIS_POOL_SIZE", "maximum redis connections, 0 for the go-redis default", &c.Redis.PoolSize},
+		{"warm-cache", "CACHE_WARM_ON_STARTUP", "rebuild the Redis cache from postgres in the background at startup", &c.Cache.WarmOnStartup},
+		{"warm-batch-size", "CACHE_WARM_BATCH_SIZE", "rows per batch when warming the cache", &c.Cache.WarmBatchSize},
+		{"warm-concurrency", "CACHE_WARM_CONCURRENCY", "batches written to Redis at the same time when warming the cache", &c.Cache.WarmConcurrency},
+		{"exporter", "EXPORTER_ENABLED", "publish every counter as gauges on /metrics/counters", &c.Exporter.Enabled},
+		{"exporter-tag", "EXPORTER_TAG", "only publish counters with this tag, unless a tag is given in the scrape URL", &c.Exporter.Tag},
+		{"exporter-tag-refresh", "EXPORTER_TAG_REFRESH", "how long the counters with a tag are remembered before asking postgres again", &c.Exporter.TagRefresh},
+		{"exporter-timeout", "EXPORTER_TIMEOUT", "how long a scrape of /metrics/counters can take", &c.Exporter.Timeout},
+		{"log-level", "LOG_LEVEL", "minimum level logged: debug, info, warn or error, debug includes every cache hit and miss", &c.Logging.Level},
+		{"log-format", "LOG_FORMAT", "log output format: json or text", &c.Logging.Format},
+		{"trace-exporter", "TRACE_EXPORTER", "where spans are sent: none, stdout or otlp", &c.Tracing.Exporter},
+		{"trace-otlp-endpoint", "OTEL_EXPORTER_OTLP_ENDPOINT", "host:port of the OTLP gRPC collector", &c.Tracing.OTLPEndpoint},
+		{"trace-otlp-insecure", "TRACE_OTLP_INSECURE", "connect to the OTLP collector without TLS", &c.Tracing.OTLPInsecure},
+		{"trace-service-name", "OTEL_SERVICE_NAME", "service.name attached to every span", &c.Tracing.ServiceName},
+		{"trace-sample-ratio", "TRACE_SAMPLE_RATIO", "fraction of new traces to sample, between 0 and 1", &c.Tracing.SampleRatio},
+	}
+}
+
+// LoadConfig registers a flag for every setting on fs, parses args and builds
+// the resulting Config. Subcommands can register their own flags on fs before
+// calling LoadConfig.
+func LoadConfig(fs *flag.FlagSet, args []string) (*Config, error) {
+	cfg := defaultConfig()
+	settings := cfg.settings()
+
+	configFile := fs.String("config", os.Getenv("COUNTERS_CONFIG"), "optional YAML config file (env COUNTERS_CONFIG)")
+
+	// flags are only recorded while parsing, and applied last so they win over
+	// the config file and environment.
+	flagValues := map[string]string{}
+	for _, s := range settings {
+		name := s.flag
+		usage := fmt.Sprintf("%s (env %s, default %s)", s.usage, s.env, formatSetting(s.ptr))
+		if _, ok := s.ptr.(*bool); ok {
+			fs.Var(boolFlag(func(v string) { flagValues[name] = v }), name, usage)
+			continue
+		}
+		fs.Func(name, usage, func(v string) error {
+			flagValues[name] = v
+			return nil
+		})
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if *configFile != "" {
+		data, err := os.ReadFile(*configFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return nil, fmt.Errorf("failed to parse config file %s: %w", *configFile, err)
+		}
+	}
+
+	for _, s := range settings {
+		v, ok := os.LookupEnv(s.env)
+		if !ok {
+			continue
+		}
+		if err := setSetting(s.ptr, v); err != nil {
+			return nil, fmt.Errorf("invalid value for %s: %w", s.env, err)
+		}
+	}
+
+	for _, s := range settings {
+		v, ok := flagValues[s.flag]
+		if !ok {
+			continue
+		}
+		if err := setSetting(s.ptr, v); err != nil {
+			return nil, fmt.Errorf("invalid value for -%s: %w", s.flag, err)
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// Validate reports every problem with the config at once, so a broken
+// deployment only needs one round trip to fix.
+func (c *Config) Validate() error {
+	var errs []error
+
+	if _, _, err := net.SplitHostPort(c.ListenAddr); err != nil {
+		errs = append(errs, fmt.Errorf("listen_addr: %w", err))
+	}
+
+	if c.HTTPListenAddr != "" {
+		if _, _, err := net.SplitHostPort(c.HTTPListenAddr); err != nil {
+			errs = append(errs, fmt.Errorf("http_listen_addr: %w", err))
+		}
+	}
+
+	if c.Web.ListenAddr != "" {
+		if _, _, err := net.SplitHostPort(c.Web.ListenAddr); err != nil {
+			errs = append(errs, fmt.Errorf("web: listen_addr: %w", err))
+		}
+	}
+	if c.Web.CORSMaxAge < 0 {
+		errs = append(errs, errors.New("web: cors_max_age must not be negative"))
+	}
+
+	if c.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("shutdown_timeout must be positive"))
+	}
+	if c.RequestTimeout < 0 {
+		errs = append(errs, errors.New("request_timeout must not be negative"))
+	}
+	if c.DrainDelay < 0 {
+		errs = append(errs, errors.New("drain_delay must not be negative"))
+	}
+
+	if c.Health.ProbeInterval <= 0 || c.Health.ProbeTimeout <= 0 {
+		errs = append(errs, errors.New("health: probe_interval and probe_timeout must be positive"))
+	}
+
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		errs = append(errs, errors.New("tls: cert_file and key_file must be set together"))
+	}
+	if c.TLS.ClientCAFile != "" && c.TLS.CertFile == "" {
+		errs = append(errs, errors.New("tls: client_ca_file requires cert_file and key_file"))
+	}
+	for _, f := range []string{c.TLS.CertFile, c.TLS.KeyFile, c.TLS.ClientCAFile} {
+		if f == "" {
+			continue
+		}
+		if _, err := os.Stat(f); err != nil {
+			errs = append(errs, fmt.Errorf("tls: %w", err))
+		}
+	}
+
+	if c.Auth.HMACSecret != "" && len(c.Auth.HMACSecret) < 32 {
+		errs = append(errs, errors.New("auth: hmac_secret must be at least 32 bytes"))
+	}
+	if c.Auth.JWKSFile != "" {
+		if _, err := os.Stat(c.Auth.JWKSFile); err != nil {
+			errs = append(errs, fmt.Errorf("auth: %w", err))
+		}
+	}
+	if !c.Auth.Enabled() && (c.Auth.Issuer != "" || c.Auth.Audience != "") {
+		errs = append(errs, errors.New("auth: issuer and audience need hmac_secret or jwks_file"))
+	}
+	if !c.Auth.Enabled() && len(c.Auth.Admins) > 0 {
+		errs = append(errs, errors.New("auth: admins need hmac_secret or jwks_file"))
+	}
+	if c.Auth.Leeway < 0 {
+		errs = append(errs, errors.New("auth: leeway must not be negative"))
+	}
+
+	if c.RateLimit.Rate < 0 {
+		errs = append(errs, errors.New("rate_limit: rate must not be negative"))
+	}
+	if c.RateLimit.Rate > 0 && c.RateLimit.Burst < 1 {
+		errs = append(errs, errors.New("rate_limit: burst must be at least 1"))
+	}
+	if c.Quotas.MaxCountersPerUser < 0 || c.Quotas.MaxEventsPerCounterPerDay < 0 {
+		errs = append(errs, errors.New("quotas: must not be negative"))
+	}
+
+	switch c.Storage {
+	case "postgres":
+		if c.Postgres.Host == "" {
+			errs = append(errs, errors.New("postgres: host is required"))
+		}
+		if c.Postgres.Port <= 0 || c.Postgres.Port > 65535 {
+			errs = append(errs, fmt.Errorf("postgres: port %d is out of range", c.Postgres.Port))
+		}
+		if c.Postgres.User == "" {
+			errs = append(errs, errors.New("postgres: user is required"))
+		}
+		if c.Postgres.DBName == "" {
+			errs = append(errs, errors.New("postgres: dbname is required"))
+		}
+		switch c.Postgres.SSLMode {
+		case "disable", "require", "verify-ca", "verify-full":
+		default:
+			errs = append(errs, fmt.Errorf("postgres: unsupported sslmode %q", c.Postgres.SSLMode))
+		}
+		if c.Postgres.MaxOpenConns < 0 || c.Postgres.MaxIdleConns < 0 {
+			errs = append(errs, errors.New("postgres: pool sizes must not be negative"))
+		}
+		if c.Postgres.MaxOpenConns > 0 && c.Postgres.MaxIdleConns > c.Postgres.MaxOpenConns {
+			errs = append(errs, errors.New("postgres: max_idle_conns must not be greater than max_open_conns"))
+		}
+		if c.Postgres.ConnMaxLifetime < 0 || c.Postgres.ConnMaxIdleTime < 0 {
+			errs = append(errs, errors.New("postgres: connection lifetimes must not be negative"))
+		}
+
+		if _, _, err := net.SplitHostPort(c.Redis.Addr); err != nil {
+			errs = append(errs, fmt.Errorf("redis: addr: %w", err))
+		}
+		if c.Redis.DB < 0 {
+			errs = append(errs, errors.New("redis: db must not be negative"))
+		}
+		if c.Redis.PoolSize < 0 {
+			errs = append(errs, errors.New("redis: pool_size must not be negative"))
+		}
+	case "sqlite":
+		if c.SQLite.Path == "" {
+			errs = append(errs, errors.New("sqlite: path is required"))
+		}
+		if c.Cache.WarmOnStartup {
+			errs = append(errs, errors.New("cache: warm_on_startup needs Redis, which isn't used with sqlite storage"))
+		}
+		if c.Exporter.Enabled {
+			errs = append(errs, errors.New("exporter: needs Redis, which isn't used with sqlite storage"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown storage %q", c.Storage))
+	}
+
+	if c.Cache.WarmBatchSize <= 0 || c.Cache.WarmConcurrency <= 0 {
+		errs = append(errs, errors.New("cache: warm_batch_size and warm_concurrency must be positive"))
+	}
+
+	if c.Exporter.Enabled {
+		if c.HTTPListenAddr == "" {
+			errs = append(errs, errors.New("exporter: requires http_listen_addr"))
+		}
+		if c.Exporter.TagRefresh < 0 || c.Exporter.Timeout <= 0 {
+			errs = append(errs, errors.New("exporter: tag_refresh must not be negative and timeout must be positive"))
+		}
+	}
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(c.Logging.Level)); err != nil {
+		errs = append(errs, fmt.Errorf("logging: %w", err))
+	}
+	if c.Logging.Format != "json" && c.Logging.Format != "text" {
+		errs = append(errs, fmt.Errorf("logging: unknown format %q", c.Logging.Format))
+	}
+
+	switch c.Tracing.Exporter {
+	case "none", "stdout":
+	case "otlp":
+		if c.Tracing.OTLPEndpoint == "" {
+			errs = append(errs, errors.New("tracing: otlp_endpoint is required for the otlp exporter"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("tracing: unknown exporter %q", c.Tracing.Exporter))
+	}
+	if c.Tracing.SampleRatio < 0 || c.Tracing.SampleRatio > 1 {
+		errs = append(errs, errors.New("tracing: sample_ratio must be between 0 and 1"))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid config: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// The lib/pq connection string for c.
+func (c *PostgresConfig) DSN() string {
+	parts := []string{
+		"host=" + quoteDSNValue(c.Host),
+		"port=" + strconv.Itoa(c.Port),
+		"user=" + quoteDSNValue(c.User),
+		"password=" + quoteDSNValue(c.Password),
+		"dbname=" + quoteDSNValue(c.DBName),
+		"sslmode=" + quoteDSNValue(c.SSLMode),
+	}
+	return strings.Join(parts, " ")
+}
+
+// Values containing spaces or quotes have to be single quoted, with quotes and
+// backslashes escaped.
+func quoteDSNValue(v string) string {
+	if v != "" && !strings.ContainsAny(v, ` '\`) {
+		return v
+	}
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, `'`, `\'`)
+	return "'" + v + "'"
+}
+
+// The server TLS config, or nil if TLS is not configured.
+func (c *TLSConfig) Load() (*tls.Config, error) {
+	if c.CertFile == "" {
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS key pair: %w", err)
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if c.ClientCAFile != "" {
+		pem, err := os.ReadFile(c.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", c.ClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsConfig, nil
+}
+
+func setSetting(ptr any, v string) error {
+	switch p := ptr.(type) {
+	case *string:
+		*p = v
+	case *[]string:
+		*p = nil
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*p = append(*p, item)
+			}
+		}
+	case *int:
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+		*p = n
+	case *bool:
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return err
+		}
+		*p = b
+	case *float64:
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return err
+		}
+		*p = f
+	case *time.Duration:
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return err
+		}
+		*p = d
+	default:
+		panic(fmt.Sprintf("unsupported setting type %T", ptr))
+	}
+	return nil
+}
+
+func formatSetting(ptr any) string {
+	switch p := ptr.(type) {
+	case *string:
+		if *p == "" {
+			return `""`
+		}
+		return *p
+	case *[]string:
+		if len(*p) == 0 {
+			return `""`
+		}
+		return strings.Join(*p, ",")
+	case *int:
+		return strconv.Itoa(*p)
+	case *bool:
+		return strconv.FormatBool(*p)
+	case *float64:
+		return strconv.FormatFloat(*p, 'g', -1, 64)
+	case *time.Duration:
+		return p.String()
+	}
+	return ""
+}
+
+// A flag.Value for boolean settings, so they can be passed as -name rather
+// than -name=true.
+type boolFlag func(string)
+
+func (f boolFlag) String() string     { return "" }
+func (f boolFlag) Set(v string) error { f(v); return nil }
+func (f boolFlag) IsBoolFlag() bool   { return true }
@@ -0,0 +1,52 @@
+// Package telemetry has the tracing helpers shared by the stores, caches and
+// server, so their spans all look alike.
+package telemetry
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/go-redis/redis/v8"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/alextebbs/counters")
+
+// Starts a span for a single SQL statement, named like "UPDATE counters".
+func StartQuerySpan(ctx context.Context, operation, table string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, operation+" "+table,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			semconv.DBOperation(operation),
+			semconv.DBSQLTable(table),
+		),
+	)
+}
+
+// Starts a span for a single Redis command, named like "redis GET".
+func StartCacheSpan(ctx context.Context, command, key string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "redis "+command,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemRedis,
+			semconv.DBOperation(command),
+			attribute.String("db.redis.key", key),
+		),
+	)
+}
+
+// Ends span, marking it as failed if err is a real error. Missing rows and
+// cache misses are expected, so they don't count.
+func EndSpan(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, sql.ErrNoRows) && !errors.Is(err, redis.Nil) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
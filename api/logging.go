@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/alextebbs/counters/server"
+)
+
+// Installs the default slog logger described by cfg, which adds the request
+// ID to lines logged with the *Context variants.
+func setupLogging(cfg LoggingConfig, w io.Writer) error {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		return fmt.Errorf("invalid log level %q: %w", cfg.Level, err)
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	switch cfg.Format {
+	case "json":
+		handler = slog.NewJSONHandler(w, opts)
+	case "text":
+		handler = slog.NewTextHandler(w, opts)
+	default:
+		return fmt.Errorf("unknown log format %q", cfg.Format)
+	}
+
+	slog.SetDefault(slog.New(server.NewLogHandler(handler)))
+	return nil
+}
+
+// Log msg and exit. Only for startup, before anything needs cleaning up.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
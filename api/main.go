@@ -3,67 +3,460 @@ package main
 import (
 	"context"
 	"database/sql"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"net"
+	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
 
-	pbcounter "github.com/alextebbs/counters/pb/counter/v1"
-	pbevent "github.com/alextebbs/counters/pb/event/v1"
+	"github.com/alextebbs/counters/auth"
+	"github.com/alextebbs/counters/cache"
+	"github.com/alextebbs/counters/ratelimit"
+	"github.com/alextebbs/counters/server"
+	"github.com/alextebbs/counters/store"
 	"github.com/go-redis/redis/v8"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/reflection"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 
 	_ "github.com/lib/pq"
 )
 
+// Usage:
+//
+//	api-server [serve] [flags]
+//	api-server warm-cache [flags]
+//	api-server check-cache [-repair] [flags]
+//	api-server migrate up|down|status [-steps n] [flags]
+//
+// Every command accepts the config flags, run with -h to list them.
 func main() {
-	host := "postgres"
-	port := 5432
-	user := os.Getenv("POSTGRES_USER")
-	password := os.Getenv("POSTGRES_PASSWORD")
-	dbname := os.Getenv("POSTGRES_DB")
+	command := "serve"
+	args := os.Args[1:]
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		command, args = args[0], args[1:]
+	}
+
+	switch command {
+	case "serve":
+		serve(args)
+	case "warm-cache":
+		warmCache(args)
+	case "check-cache":
+		checkCache(args)
+	case "migrate":
+		migrate(args)
+	default:
+		fatal("Unknown command, expected one of: serve, warm-cache, check-cache, migrate", "command", command)
+	}
+}
+
+func serve(args []string) {
+	cfg := mustLoadConfig(flag.NewFlagSet("serve", flag.ExitOnError), args)
+
+	// cancelled on SIGTERM (sent by k8s during rolling updates) or ctrl-c, which
+	// also tells background workers to stop.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	shutdownTracing, err := setupTracing(ctx, cfg.Tracing)
+	if err != nil {
+		fatal("Failed to set up tracing", "err", err)
+	}
+
+	db := openDatabase(cfg)
+	dbName := cfg.Postgres.DBName
+	if cfg.Storage == "sqlite" {
+		dbName = cfg.SQLite.Path
+	}
+	prometheus.MustRegister(collectors.NewDBStatsCollector(db, dbName))
+
+	// a SQLite file has nobody else to create its schema
+	if cfg.Postgres.MigrateOnStartup || cfg.Storage == "sqlite" {
+		migrator, err := store.NewMigrator(db, cfg.Storage)
+		if err != nil {
+			fatal("Failed to load migrations", "err", err)
+		}
+		if _, err := migrator.Up(ctx); err != nil {
+			fatal("Failed to migrate database", "err", err)
+		}
+	}
 
-	psqlInfo := fmt.Sprintf("sslmode=disable host=%s port=%d user=%s password=%s dbname=%s",
-		host, port, user, password, dbname)
+	opts := server.Options{
+		DB:              db,
+		WarmBatchSize:   cfg.Cache.WarmBatchSize,
+		WarmConcurrency: cfg.Cache.WarmConcurrency,
+		RequestTimeout:  cfg.RequestTimeout,
+		HealthChecks:    map[string]server.HealthCheck{server.DependencyDatabase: db.PingContext},
+		HealthInterval:  cfg.Health.ProbeInterval,
+		HealthTimeout:   cfg.Health.ProbeTimeout,
+		AllowedOrigins:  cfg.Web.AllowedOrigins,
+		CORSMaxAge:      cfg.Web.CORSMaxAge,
+		Quotas: server.Quotas{
+			MaxCountersPerUser:        cfg.Quotas.MaxCountersPerUser,
+			MaxEventsPerCounterPerDay: cfg.Quotas.MaxEventsPerCounterPerDay,
+		},
+	}
+
+	if cfg.Auth.Enabled() {
+		authenticator, err := auth.NewJWTAuthenticator(auth.JWTOptions{
+			HMACSecret: []byte(cfg.Auth.HMACSecret),
+			JWKSFile:   cfg.Auth.JWKSFile,
+			Issuer:     cfg.Auth.Issuer,
+			Audience:   cfg.Auth.Audience,
+			Leeway:     cfg.Auth.Leeway,
+		})
+		if err != nil {
+			fatal("Failed to set up authentication", "err", err)
+		}
+		opts.Auth = authenticator
+		opts.Admins = cfg.Auth.Admins
+		if len(opts.Admins) == 0 {
+			slog.Warn("No admins are configured, so nobody can call AdminService or create admin API keys")
+		}
+	} else {
+		slog.Warn("Authentication is disabled, anyone who can reach the server can read and change every counter")
+	}
 
-	db, err := sql.Open("postgres", psqlInfo)
+	var redisService *cache.RedisService
+	var limiter ratelimit.Limiter
+	switch cfg.Storage {
+	case "sqlite":
+		opts.Store = store.NewSQLiteStore(db)
+		limiter = ratelimit.NewLocalLimiter()
+	default:
+		opts.Store = store.NewPostgresStore(db)
+		redisClient := connectRedis(cfg.Redis)
+		redisService = cache.NewRedisService(redisClient)
+		opts.Cache = redisService
+		opts.Redis = redisService
+		opts.HealthChecks[server.DependencyRedis] = redisService.Ping
+		limiter = ratelimit.NewRedisLimiter(redisClient)
+	}
+	if cfg.RateLimit.Rate > 0 {
+		opts.RateLimiter = limiter
+		opts.RateLimit = ratelimit.Limit{Rate: cfg.RateLimit.Rate, Burst: cfg.RateLimit.Burst}
+	}
+
+	tlsConfig, err := cfg.TLS.Load()
 	if err != nil {
-		log.Fatalf("failed to open database: %v", err)
+		fatal("Failed to configure TLS", "err", err)
+	}
+	opts.TLS = tlsConfig
+
+	s, err := server.New(opts)
+	if err != nil {
+		fatal("Failed to set up server", "err", err)
+	}
+
+	lis, err := net.Listen("tcp", cfg.ListenAddr)
+	if err != nil {
+		fatal("Failed to listen", "err", err)
+	}
+
+	var workers sync.WaitGroup
+
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		s.Run(ctx)
+	}()
+
+	// the cache is read-through, so the server can start taking requests while
+	// the warm-up is still running.
+	if cfg.Cache.WarmOnStartup {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			if _, err := s.Warmer().Warm(ctx, logWarmProgress); err != nil {
+				slog.ErrorContext(ctx, "Failed to warm cache at startup", "err", err)
+			}
+		}()
+	}
+
+	slog.Info("gRPC server listening", "addr", lis.Addr().String())
+
+	serveErr := make(chan error, 3)
+	go func() {
+		serveErr <- s.Serve(lis)
+	}()
+
+	// the same services again for browsers, which can't speak gRPC to lis
+	var webServer *http.Server
+	if cfg.Web.ListenAddr != "" {
+		handler, err := s.WebHandler()
+		if err != nil {
+			fatal("Failed to set up web handler", "err", err)
+		}
+		webServer = server.NewWebServer(cfg.Web.ListenAddr, handler, tlsConfig)
+
+		slog.Info("Web server listening", "addr", cfg.Web.ListenAddr, "allowed_origins", cfg.Web.AllowedOrigins)
+		go func() {
+			var err error
+			if tlsConfig != nil {
+				err = webServer.ListenAndServeTLS("", "")
+			} else {
+				err = webServer.ListenAndServe()
+			}
+			if err != http.ErrServerClosed {
+				serveErr <- err
+			}
+		}()
+	}
+
+	var httpServer *http.Server
+	if cfg.HTTPListenAddr != "" {
+		mux := http.NewServeMux()
+		s.Health().RegisterHandlers(mux)
+		mux.Handle("/metrics", promhttp.Handler())
+		if cfg.Exporter.Enabled {
+			mux.Handle("/metrics/counters", server.NewCounterExporter(db, redisService, cfg.Exporter.Tag, cfg.Exporter.TagRefresh, cfg.Exporter.Timeout))
+		}
+		httpServer = &http.Server{Addr: cfg.HTTPListenAddr, Handler: mux}
+
+		slog.Info("HTTP server listening", "addr", cfg.HTTPListenAddr)
+		go func() {
+			if err := httpServer.ListenAndServe(); err != http.ErrServerClosed {
+				serveErr <- err
+			}
+		}()
+	}
+
+	select {
+	case err := <-serveErr:
+		fatal("Failed to serve", "err", err)
+	case <-ctx.Done():
+	}
+
+	slog.Info("Shutting down, draining connections", "drain_delay", cfg.DrainDelay, "timeout", cfg.ShutdownTimeout)
+	s.Drain()
+
+	// give load balancers a chance to notice we're not ready before we stop
+	// accepting new connections.
+	time.Sleep(cfg.DrainDelay)
+
+	// the web server's requests end up in s as well, so it's stopped first and
+	// gets the same time to finish them.
+	stopped := make(chan struct{})
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	go func() {
+		if webServer != nil {
+			if err := webServer.Shutdown(shutdownCtx); err != nil {
+				slog.Error("Failed to shut down web server", "err", err)
+			}
+		}
+		s.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-shutdownCtx.Done():
+		slog.Warn("In-flight requests did not finish in time, forcing shutdown", "timeout", cfg.ShutdownTimeout)
+		if webServer != nil {
+			webServer.Close()
+		}
+		s.Stop()
+	}
+	cancelShutdown()
+
+	// the HTTP server only answers probes and scrapes, so it can stay up until now to keep
+	// reporting not-ready while gRPC drains.
+	if httpServer != nil {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+		if err := httpServer.Shutdown(shutdownCtx); err != nil {
+			slog.Error("Failed to shut down HTTP server", "err", err)
+		}
+		cancel()
+	}
+
+	// handlers are finished with postgres and Redis now, wait for anything
+	// running in the background to notice ctx is done before closing them.
+	workers.Wait()
+
+	if err := db.Close(); err != nil {
+		slog.Error("Failed to close database", "err", err)
+	}
+	if redisService != nil {
+		if err := redisService.Close(); err != nil {
+			slog.Error("Failed to close Redis client", "err", err)
+		}
+	}
+
+	// flush whatever spans are still buffered
+	tracingCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if err := shutdownTracing(tracingCtx); err != nil {
+		slog.Error("Failed to flush traces", "err", err)
 	}
+	cancel()
+
+	slog.Info("Server stopped")
+}
+
+func warmCache(args []string) {
+	cfg := mustLoadConfig(flag.NewFlagSet("warm-cache", flag.ExitOnError), args)
+	if cfg.Storage != "postgres" {
+		fatal("warm-cache only works with postgres storage, there's no Redis cache otherwise", "storage", cfg.Storage)
+	}
+
+	db := connectPostgres(cfg.Postgres)
 	defer db.Close()
 
-	err = db.Ping()
+	warmer := cache.NewWarmer(db, cache.NewRedisService(connectRedis(cfg.Redis)), cfg.Cache.WarmBatchSize, cfg.Cache.WarmConcurrency)
+
+	p, err := warmer.Warm(context.Background(), logWarmProgress)
 	if err != nil {
-		log.Fatalf("failed to connect to database: %v", err)
+		fatal("Failed to warm cache", "err", err)
 	}
 
-	redisClient := redis.NewClient(&redis.Options{
-		Addr: "redis:6379",
-	})
+	fmt.Printf("wrote %d counter keys and %d event keys\n", p.Counters, p.Events)
+}
+
+func checkCache(args []string) {
+	fs := flag.NewFlagSet("check-cache", flag.ExitOnError)
+	repair := fs.Bool("repair", false, "delete divergent keys, to be cached again from postgres on their next read")
+	cfg := mustLoadConfig(fs, args)
+	if cfg.Storage != "postgres" {
+		fatal("check-cache only works with postgres storage, there's no Redis cache otherwise", "storage", cfg.Storage)
+	}
+
+	db := connectPostgres(cfg.Postgres)
+	defer db.Close()
+
+	checker := cache.NewChecker(db, cache.NewRedisService(connectRedis(cfg.Redis)))
 
-	_, err = redisClient.Ping(context.Background()).Result()
+	result, err := checker.Check(context.Background(), *repair)
 	if err != nil {
-		log.Fatalf("failed to connect to Redis: %v", err)
+		fatal("Failed to check cache", "err", err)
 	}
 
-	redisService := NewRedisService(redisClient)
+	for _, d := range result.Divergences {
+		fmt.Printf("%s\t%s\t%s\tcached=%s\tstored=%s\n", d.Key, d.Field, d.Reason, d.Cached, d.Stored)
+	}
+	fmt.Printf("checked %d keys, found %d divergences, repaired %d keys\n", result.Checked, len(result.Divergences), result.Repaired)
 
-	lis, err := net.Listen("tcp", ":50051")
+	// exit non-zero so cron jobs and CI notice when the cache has drifted
+	if len(result.Divergences) > 0 && !*repair {
+		os.Exit(1)
+	}
+}
+
+func migrate(args []string) {
+	action := ""
+	if len(args) > 0 {
+		action, args = args[0], args[1:]
+	}
+
+	fs := flag.NewFlagSet("migrate "+action, flag.ExitOnError)
+	steps := fs.Int("steps", 1, "number of migrations to revert with down")
+	cfg := mustLoadConfig(fs, args)
+
+	db := openDatabase(cfg)
+	defer db.Close()
+
+	migrator, err := store.NewMigrator(db, cfg.Storage)
 	if err != nil {
-		log.Fatalf("failed to listen: %v", err)
+		fatal("Failed to load migrations", "err", err)
 	}
 
-	s := grpc.NewServer()
+	ctx := context.Background()
 
-	pbcounter.RegisterCounterServiceServer(s, &counterServer{db: db, redis: redisService})
-	pbevent.RegisterEventServiceServer(s, &eventServer{db: db, redis: redisService})
+	switch action {
+	case "up":
+		n, err := migrator.Up(ctx)
+		if err != nil {
+			fatal("Failed to migrate database", "err", err)
+		}
+		fmt.Printf("applied %d migrations\n", n)
+	case "down":
+		n, err := migrator.Down(ctx, *steps)
+		if err != nil {
+			fatal("Failed to revert migrations", "err", err)
+		}
+		fmt.Printf("reverted %d migrations\n", n)
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			fatal("Failed to get migration status", "err", err)
+		}
+		for _, s := range statuses {
+			applied := "pending"
+			if !s.AppliedAt.IsZero() {
+				applied = s.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Printf("%04d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+	default:
+		fatal("Unknown migrate action, expected one of: up, down, status", "action", action)
+	}
+}
 
-	reflection.Register(s)
+func logWarmProgress(p cache.WarmProgress) {
+	slog.Info("Warming cache", "counters", p.Counters, "events", p.Events)
+}
+
+// Load the config for a command and set up logging with it.
+func mustLoadConfig(fs *flag.FlagSet, args []string) *Config {
+	cfg, err := LoadConfig(fs, args)
+	if err != nil {
+		fatal("Failed to load config", "err", err)
+	}
 
-	log.Printf("server listening at %v", lis.Addr())
+	if err := setupLogging(cfg.Logging, os.Stderr); err != nil {
+		fatal("Failed to set up logging", "err", err)
+	}
+
+	return cfg
+}
 
-	if err := s.Serve(lis); err != nil {
-		log.Fatalf("failed to serve: %v", err)
+// Connects to whichever database cfg.Storage says to use.
+func openDatabase(cfg *Config) *sql.DB {
+	if cfg.Storage == "sqlite" {
+		db, err := store.OpenSQLite(cfg.SQLite.Path)
+		if err != nil {
+			fatal("Failed to open SQLite database", "path", cfg.SQLite.Path, "err", err)
+		}
+		return db
 	}
+	return connectPostgres(cfg.Postgres)
+}
+
+func connectPostgres(cfg PostgresConfig) *sql.DB {
+	db, err := sql.Open("postgres", cfg.DSN())
+	if err != nil {
+		fatal("Failed to open database", "err", err)
+	}
+
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+
+	err = db.Ping()
+	if err != nil {
+		fatal("Failed to connect to database", "err", err)
+	}
+
+	return db
+}
+
+func connectRedis(cfg RedisConfig) *redis.Client {
+	redisClient := redis.NewClient(&redis.Options{
+		Addr:     cfg.Addr,
+		Password: cfg.Password,
+		DB:       cfg.DB,
+		PoolSize: cfg.PoolSize,
+	})
+
+	_, err := redisClient.Ping(context.Background()).Result()
+	if err != nil {
+		fatal("Failed to connect to Redis", "err", err)
+	}
+
+	return redisClient
 }
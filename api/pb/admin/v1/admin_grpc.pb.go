@@ -0,0 +1,182 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: admin/v1/admin.proto
+
+package admin
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	AdminService_WarmCache_FullMethodName  = "/admin.v1.AdminService/WarmCache"
+	AdminService_CheckCache_FullMethodName = "/admin.v1.AdminService/CheckCache"
+)
+
+// AdminServiceClient is the client API for AdminService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type AdminServiceClient interface {
+	// Rebuild the counter:* and event:* cache keys from postgres, streaming
+	// progress as each batch is written
+	WarmCache(ctx context.Context, in *AdminServiceWarmCacheRequest, opts ...grpc.CallOption) (AdminService_WarmCacheClient, error)
+	// Compare every cached counter:* and event:* entry with postgres, reporting
+	// and optionally repairing divergences
+	CheckCache(ctx context.Context, in *AdminServiceCheckCacheRequest, opts ...grpc.CallOption) (*AdminServiceCheckCacheResponse, error)
+}
+
+type adminServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAdminServiceClient(cc grpc.ClientConnInterface) AdminServiceClient {
+	return &adminServiceClient{cc}
+}
+
+func (c *adminServiceClient) WarmCache(ctx context.Context, in *AdminServiceWarmCacheRequest, opts ...grpc.CallOption) (AdminService_WarmCacheClient, error) {
+	stream, err := c.cc.NewStream(ctx, &AdminService_ServiceDesc.Streams[0], AdminService_WarmCache_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &adminServiceWarmCacheClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type AdminService_WarmCacheClient interface {
+	Recv() (*AdminServiceWarmCacheResponse, error)
+	grpc.ClientStream
+}
+
+type adminServiceWarmCacheClient struct {
+	grpc.ClientStream
+}
+
+func (x *adminServiceWarmCacheClient) Recv() (*AdminServiceWarmCacheResponse, error) {
+	m := new(AdminServiceWarmCacheResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *adminServiceClient) CheckCache(ctx context.Context, in *AdminServiceCheckCacheRequest, opts ...grpc.CallOption) (*AdminServiceCheckCacheResponse, error) {
+	out := new(AdminServiceCheckCacheResponse)
+	err := c.cc.Invoke(ctx, AdminService_CheckCache_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AdminServiceServer is the server API for AdminService service.
+// All implementations must embed UnimplementedAdminServiceServer
+// for forward compatibility
+type AdminServiceServer interface {
+	// Rebuild the counter:* and event:* cache keys from postgres, streaming
+	// progress as each batch is written
+	WarmCache(*AdminServiceWarmCacheRequest, AdminService_WarmCacheServer) error
+	// Compare every cached counter:* and event:* entry with postgres, reporting
+	// and optionally repairing divergences
+	CheckCache(context.Context, *AdminServiceCheckCacheRequest) (*AdminServiceCheckCacheResponse, error)
+	mustEmbedUnimplementedAdminServiceServer()
+}
+
+// UnimplementedAdminServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedAdminServiceServer struct {
+}
+
+func (UnimplementedAdminServiceServer) WarmCache(*AdminServiceWarmCacheRequest, AdminService_WarmCacheServer) error {
+	return status.Errorf(codes.Unimplemented, "method WarmCache not implemented")
+}
+func (UnimplementedAdminServiceServer) CheckCache(context.Context, *AdminServiceCheckCacheRequest) (*AdminServiceCheckCacheResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CheckCache not implemented")
+}
+func (UnimplementedAdminServiceServer) mustEmbedUnimplementedAdminServiceServer() {}
+
+// UnsafeAdminServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to AdminServiceServer will
+// result in compilation errors.
+type UnsafeAdminServiceServer interface {
+	mustEmbedUnimplementedAdminServiceServer()
+}
+
+func RegisterAdminServiceServer(s grpc.ServiceRegistrar, srv AdminServiceServer) {
+	s.RegisterService(&AdminService_ServiceDesc, srv)
+}
+
+func _AdminService_WarmCache_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(AdminServiceWarmCacheRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(AdminServiceServer).WarmCache(m, &adminServiceWarmCacheServer{stream})
+}
+
+type AdminService_WarmCacheServer interface {
+	Send(*AdminServiceWarmCacheResponse) error
+	grpc.ServerStream
+}
+
+type adminServiceWarmCacheServer struct {
+	grpc.ServerStream
+}
+
+func (x *adminServiceWarmCacheServer) Send(m *AdminServiceWarmCacheResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _AdminService_CheckCache_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AdminServiceCheckCacheRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdminServiceServer).CheckCache(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AdminService_CheckCache_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdminServiceServer).CheckCache(ctx, req.(*AdminServiceCheckCacheRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// AdminService_ServiceDesc is the grpc.ServiceDesc for AdminService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var AdminService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "admin.v1.AdminService",
+	HandlerType: (*AdminServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CheckCache",
+			Handler:    _AdminService_CheckCache_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WarmCache",
+			Handler:       _AdminService_WarmCache_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "admin/v1/admin.proto",
+}
@@ -0,0 +1,189 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: key/v1/key.proto
+
+package key
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	KeyService_Create_FullMethodName = "/key.v1.KeyService/Create"
+	KeyService_List_FullMethodName   = "/key.v1.KeyService/List"
+	KeyService_Revoke_FullMethodName = "/key.v1.KeyService/Revoke"
+)
+
+// KeyServiceClient is the client API for KeyService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type KeyServiceClient interface {
+	// Create an API key
+	Create(ctx context.Context, in *KeyServiceCreateRequest, opts ...grpc.CallOption) (*KeyServiceCreateResponse, error)
+	// List the caller's API keys
+	List(ctx context.Context, in *KeyServiceListRequest, opts ...grpc.CallOption) (*KeyServiceListResponse, error)
+	// Revoke an API key, which stops working straight away
+	Revoke(ctx context.Context, in *KeyServiceRevokeRequest, opts ...grpc.CallOption) (*KeyServiceRevokeResponse, error)
+}
+
+type keyServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewKeyServiceClient(cc grpc.ClientConnInterface) KeyServiceClient {
+	return &keyServiceClient{cc}
+}
+
+func (c *keyServiceClient) Create(ctx context.Context, in *KeyServiceCreateRequest, opts ...grpc.CallOption) (*KeyServiceCreateResponse, error) {
+	out := new(KeyServiceCreateResponse)
+	err := c.cc.Invoke(ctx, KeyService_Create_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *keyServiceClient) List(ctx context.Context, in *KeyServiceListRequest, opts ...grpc.CallOption) (*KeyServiceListResponse, error) {
+	out := new(KeyServiceListResponse)
+	err := c.cc.Invoke(ctx, KeyService_List_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *keyServiceClient) Revoke(ctx context.Context, in *KeyServiceRevokeRequest, opts ...grpc.CallOption) (*KeyServiceRevokeResponse, error) {
+	out := new(KeyServiceRevokeResponse)
+	err := c.cc.Invoke(ctx, KeyService_Revoke_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// KeyServiceServer is the server API for KeyService service.
+// All implementations must embed UnimplementedKeyServiceServer
+// for forward compatibility
+type KeyServiceServer interface {
+	// Create an API key
+	Create(context.Context, *KeyServiceCreateRequest) (*KeyServiceCreateResponse, error)
+	// List the caller's API keys
+	List(context.Context, *KeyServiceListRequest) (*KeyServiceListResponse, error)
+	// Revoke an API key, which stops working straight away
+	Revoke(context.Context, *KeyServiceRevokeRequest) (*KeyServiceRevokeResponse, error)
+	mustEmbedUnimplementedKeyServiceServer()
+}
+
+// UnimplementedKeyServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedKeyServiceServer struct {
+}
+
+func (UnimplementedKeyServiceServer) Create(context.Context, *KeyServiceCreateRequest) (*KeyServiceCreateResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Create not implemented")
+}
+func (UnimplementedKeyServiceServer) List(context.Context, *KeyServiceListRequest) (*KeyServiceListResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method List not implemented")
+}
+func (UnimplementedKeyServiceServer) Revoke(context.Context, *KeyServiceRevokeRequest) (*KeyServiceRevokeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Revoke not implemented")
+}
+func (UnimplementedKeyServiceServer) mustEmbedUnimplementedKeyServiceServer() {}
+
+// UnsafeKeyServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to KeyServiceServer will
+// result in compilation errors.
+type UnsafeKeyServiceServer interface {
+	mustEmbedUnimplementedKeyServiceServer()
+}
+
+func RegisterKeyServiceServer(s grpc.ServiceRegistrar, srv KeyServiceServer) {
+	s.RegisterService(&KeyService_ServiceDesc, srv)
+}
+
+func _KeyService_Create_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KeyServiceCreateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KeyServiceServer).Create(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KeyService_Create_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KeyServiceServer).Create(ctx, req.(*KeyServiceCreateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KeyService_List_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KeyServiceListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KeyServiceServer).List(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KeyService_List_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KeyServiceServer).List(ctx, req.(*KeyServiceListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KeyService_Revoke_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KeyServiceRevokeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KeyServiceServer).Revoke(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KeyService_Revoke_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KeyServiceServer).Revoke(ctx, req.(*KeyServiceRevokeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// KeyService_ServiceDesc is the grpc.ServiceDesc for KeyService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var KeyService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "key.v1.KeyService",
+	HandlerType: (*KeyServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Create",
+			Handler:    _KeyService_Create_Handler,
+		},
+		{
+			MethodName: "List",
+			Handler:    _KeyService_List_Handler,
+		},
+		{
+			MethodName: "Revoke",
+			Handler:    _KeyService_Revoke_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "key/v1/key.proto",
+}
@@ -0,0 +1,269 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: member/v1/member.proto
+
+package member
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	MemberService_List_FullMethodName         = "/member.v1.MemberService/List"
+	MemberService_Set_FullMethodName          = "/member.v1.MemberService/Set"
+	MemberService_Remove_FullMethodName       = "/member.v1.MemberService/Remove"
+	MemberService_CreateInvite_FullMethodName = "/member.v1.MemberService/CreateInvite"
+	MemberService_AcceptInvite_FullMethodName = "/member.v1.MemberService/AcceptInvite"
+)
+
+// MemberServiceClient is the client API for MemberService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type MemberServiceClient interface {
+	// List everyone who has access to a counter
+	List(ctx context.Context, in *MemberServiceListRequest, opts ...grpc.CallOption) (*MemberServiceListResponse, error)
+	// Give a user a role on a counter, or change the role they have
+	Set(ctx context.Context, in *MemberServiceSetRequest, opts ...grpc.CallOption) (*MemberServiceSetResponse, error)
+	// Take away a user's access to a counter. Anyone can remove themselves,
+	// except the last owner
+	Remove(ctx context.Context, in *MemberServiceRemoveRequest, opts ...grpc.CallOption) (*MemberServiceRemoveResponse, error)
+	// Create a code which gives whoever accepts it a role on a counter
+	CreateInvite(ctx context.Context, in *MemberServiceCreateInviteRequest, opts ...grpc.CallOption) (*MemberServiceCreateInviteResponse, error)
+	// Join a counter with an invite code
+	AcceptInvite(ctx context.Context, in *MemberServiceAcceptInviteRequest, opts ...grpc.CallOption) (*MemberServiceAcceptInviteResponse, error)
+}
+
+type memberServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewMemberServiceClient(cc grpc.ClientConnInterface) MemberServiceClient {
+	return &memberServiceClient{cc}
+}
+
+func (c *memberServiceClient) List(ctx context.Context, in *MemberServiceListRequest, opts ...grpc.CallOption) (*MemberServiceListResponse, error) {
+	out := new(MemberServiceListResponse)
+	err := c.cc.Invoke(ctx, MemberService_List_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *memberServiceClient) Set(ctx context.Context, in *MemberServiceSetRequest, opts ...grpc.CallOption) (*MemberServiceSetResponse, error) {
+	out := new(MemberServiceSetResponse)
+	err := c.cc.Invoke(ctx, MemberService_Set_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *memberServiceClient) Remove(ctx context.Context, in *MemberServiceRemoveRequest, opts ...grpc.CallOption) (*MemberServiceRemoveResponse, error) {
+	out := new(MemberServiceRemoveResponse)
+	err := c.cc.Invoke(ctx, MemberService_Remove_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *memberServiceClient) CreateInvite(ctx context.Context, in *MemberServiceCreateInviteRequest, opts ...grpc.CallOption) (*MemberServiceCreateInviteResponse, error) {
+	out := new(MemberServiceCreateInviteResponse)
+	err := c.cc.Invoke(ctx, MemberService_CreateInvite_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *memberServiceClient) AcceptInvite(ctx context.Context, in *MemberServiceAcceptInviteRequest, opts ...grpc.CallOption) (*MemberServiceAcceptInviteResponse, error) {
+	out := new(MemberServiceAcceptInviteResponse)
+	err := c.cc.Invoke(ctx, MemberService_AcceptInvite_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// MemberServiceServer is the server API for MemberService service.
+// All implementations must embed UnimplementedMemberServiceServer
+// for forward compatibility
+type MemberServiceServer interface {
+	// List everyone who has access to a counter
+	List(context.Context, *MemberServiceListRequest) (*MemberServiceListResponse, error)
+	// Give a user a role on a counter, or change the role they have
+	Set(context.Context, *MemberServiceSetRequest) (*MemberServiceSetResponse, error)
+	// Take away a user's access to a counter. Anyone can remove themselves,
+	// except the last owner
+	Remove(context.Context, *MemberServiceRemoveRequest) (*MemberServiceRemoveResponse, error)
+	// Create a code which gives whoever accepts it a role on a counter
+	CreateInvite(context.Context, *MemberServiceCreateInviteRequest) (*MemberServiceCreateInviteResponse, error)
+	// Join a counter with an invite code
+	AcceptInvite(context.Context, *MemberServiceAcceptInviteRequest) (*MemberServiceAcceptInviteResponse, error)
+	mustEmbedUnimplementedMemberServiceServer()
+}
+
+// UnimplementedMemberServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedMemberServiceServer struct {
+}
+
+func (UnimplementedMemberServiceServer) List(context.Context, *MemberServiceListRequest) (*MemberServiceListResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method List not implemented")
+}
+func (UnimplementedMemberServiceServer) Set(context.Context, *MemberServiceSetRequest) (*MemberServiceSetResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Set not implemented")
+}
+func (UnimplementedMemberServiceServer) Remove(context.Context, *MemberServiceRemoveRequest) (*MemberServiceRemoveResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Remove not implemented")
+}
+func (UnimplementedMemberServiceServer) CreateInvite(context.Context, *MemberServiceCreateInviteRequest) (*MemberServiceCreateInviteResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateInvite not implemented")
+}
+func (UnimplementedMemberServiceServer) AcceptInvite(context.Context, *MemberServiceAcceptInviteRequest) (*MemberServiceAcceptInviteResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AcceptInvite not implemented")
+}
+func (UnimplementedMemberServiceServer) mustEmbedUnimplementedMemberServiceServer() {}
+
+// UnsafeMemberServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to MemberServiceServer will
+// result in compilation errors.
+type UnsafeMemberServiceServer interface {
+	mustEmbedUnimplementedMemberServiceServer()
+}
+
+func RegisterMemberServiceServer(s grpc.ServiceRegistrar, srv MemberServiceServer) {
+	s.RegisterService(&MemberService_ServiceDesc, srv)
+}
+
+func _MemberService_List_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MemberServiceListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MemberServiceServer).List(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MemberService_List_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MemberServiceServer).List(ctx, req.(*MemberServiceListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MemberService_Set_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MemberServiceSetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MemberServiceServer).Set(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MemberService_Set_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MemberServiceServer).Set(ctx, req.(*MemberServiceSetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MemberService_Remove_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MemberServiceRemoveRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MemberServiceServer).Remove(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MemberService_Remove_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MemberServiceServer).Remove(ctx, req.(*MemberServiceRemoveRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MemberService_CreateInvite_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MemberServiceCreateInviteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MemberServiceServer).CreateInvite(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MemberService_CreateInvite_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MemberServiceServer).CreateInvite(ctx, req.(*MemberServiceCreateInviteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MemberService_AcceptInvite_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MemberServiceAcceptInviteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MemberServiceServer).AcceptInvite(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MemberService_AcceptInvite_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MemberServiceServer).AcceptInvite(ctx, req.(*MemberServiceAcceptInviteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// MemberService_ServiceDesc is the grpc.ServiceDesc for MemberService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var MemberService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "member.v1.MemberService",
+	HandlerType: (*MemberServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "List",
+			Handler:    _MemberService_List_Handler,
+		},
+		{
+			MethodName: "Set",
+			Handler:    _MemberService_Set_Handler,
+		},
+		{
+			MethodName: "Remove",
+			Handler:    _MemberService_Remove_Handler,
+		},
+		{
+			MethodName: "CreateInvite",
+			Handler:    _MemberService_CreateInvite_Handler,
+		},
+		{
+			MethodName: "AcceptInvite",
+			Handler:    _MemberService_AcceptInvite_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "member/v1/member.proto",
+}
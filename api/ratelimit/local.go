@@ -0,0 +1,56 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// A Limiter kept in the server's own memory, for running without Redis.
+// Replicas each have their own buckets, so it's only right for one.
+type LocalLimiter struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewLocalLimiter() *LocalLimiter {
+	return &LocalLimiter{buckets: map[string]*bucket{}, now: time.Now}
+}
+
+// SetClock replaces time.Now, for tests.
+func (l *LocalLimiter) SetClock(now func() time.Time) {
+	l.now = now
+}
+
+func (l *LocalLimiter) Allow(ctx context.Context, key string, limit Limit) (bool, time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now, limit)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), at: now}
+		l.buckets[key] = b
+	}
+	ok, retryAfter := b.take(now, limit)
+	return ok, retryAfter, nil
+}
+
+// Forgets buckets which have filled up again, which are the same as new ones,
+// so callers who have gone away don't stay in memory.
+func (l *LocalLimiter) sweep(now time.Time, limit Limit) {
+	full := fillTime(limit)
+	if now.Sub(l.lastSweep) < full {
+		return
+	}
+	for key, b := range l.buckets {
+		if now.Sub(b.at) >= full {
+			delete(l.buckets, key)
+		}
+	}
+	l.lastSweep = now
+}
@@ -0,0 +1,53 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLocalLimiter(t *testing.T) {
+	limit := Limit{Rate: 2, Burst: 3}
+
+	tests := []struct {
+		name           string
+		calls          []time.Duration // how long to wait before each call
+		wantOK         []bool
+		wantRetryAfter time.Duration // for the last call
+	}{
+		{name: "burst", calls: []time.Duration{0, 0, 0}, wantOK: []bool{true, true, true}},
+		{name: "empty", calls: []time.Duration{0, 0, 0, 0}, wantOK: []bool{true, true, true, false}, wantRetryAfter: 500 * time.Millisecond},
+		{name: "refilled", calls: []time.Duration{0, 0, 0, 500 * time.Millisecond}, wantOK: []bool{true, true, true, true}},
+		{name: "partly refilled", calls: []time.Duration{0, 0, 0, 250 * time.Millisecond}, wantOK: []bool{true, true, true, false}, wantRetryAfter: 250 * time.Millisecond},
+		{name: "never more than burst", calls: []time.Duration{time.Hour, 0, 0, 0}, wantOK: []bool{true, true, true, false}, wantRetryAfter: 500 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+			l := NewLocalLimiter()
+			l.SetClock(func() time.Time { return now })
+
+			var retryAfter time.Duration
+			for i, wait := range tt.calls {
+				now = now.Add(wait)
+				ok, ra, err := l.Allow(context.Background(), "alice", limit)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if ok != tt.wantOK[i] {
+					t.Errorf("call %d allowed = %v, want %v", i, ok, tt.wantOK[i])
+				}
+				retryAfter = ra
+			}
+			if retryAfter != tt.wantRetryAfter {
+				t.Errorf("retry after %v, want %v", retryAfter, tt.wantRetryAfter)
+			}
+
+			// other keys have their own buckets
+			if ok, _, _ := l.Allow(context.Background(), "bob", limit); !ok {
+				t.Error("bob was limited by alice's calls")
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+// Package ratelimit has token buckets, kept in Redis so every replica shares
+// them, or in the process's own memory when there's only one.
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// How quickly a bucket refills and how much it holds. Callers can make Burst
+// calls at once, then Rate a second.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Takes tokens out of buckets, each named by a key.
+type Limiter interface {
+	// Allow takes a token from key's bucket, filling it first if it's new. If
+	// the bucket is empty it returns false, along with how long until there's
+	// a token again.
+	Allow(ctx context.Context, key string, limit Limit) (ok bool, retryAfter time.Duration, err error)
+}
+
+// What's in a bucket, refilled from when it was last looked at.
+type bucket struct {
+	tokens float64
+	at     time.Time
+}
+
+// Refills b up to now and takes a token if there's one. Matches the Lua
+// script RedisLimiter runs.
+func (b *bucket) take(now time.Time, limit Limit) (bool, time.Duration) {
+	if elapsed := now.Sub(b.at).Seconds(); elapsed > 0 {
+		b.tokens = min(float64(limit.Burst), b.tokens+elapsed*limit.Rate)
+	}
+	b.at = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+}
+
+// How long until a bucket is full again, after which it can be forgotten.
+func fillTime(limit Limit) time.Duration {
+	return time.Duration(float64(limit.Burst) / limit.Rate * float64(time.Second))
+}
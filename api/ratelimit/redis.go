@@ -0,0 +1,59 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+
+	"github.com/alextebbs/counters/internal/telemetry"
+	"github.com/go-redis/redis/v8"
+)
+
+// The same as bucket.take, run in Redis so checking and taking a token is one
+// step however many replicas share the bucket. Times come from Redis rather
+// than the replicas, whose clocks might not agree.
+var takeScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local time = redis.call("TIME")
+-- in milliseconds, since Lua would print microseconds in scientific notation
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+
+local b = redis.call("HMGET", KEYS[1], "tokens", "at")
+local tokens = tonumber(b[1]) or burst
+local at = tonumber(b[2]) or now
+if now > at then
+	tokens = math.min(burst, tokens + (now - at) / 1000 * rate)
+end
+
+local ok, wait = 0, 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	ok = 1
+else
+	wait = math.ceil((1 - tokens) / rate * 1000)
+end
+
+redis.call("HSET", KEYS[1], "tokens", tokens, "at", now)
+redis.call("PEXPIRE", KEYS[1], math.ceil(burst / rate * 1000))
+return {ok, wait}
+`)
+
+// A Limiter whose buckets are hashes in Redis, shared by every replica. Buckets
+// expire once they'd be full again.
+type RedisLimiter struct {
+	client *redis.Client
+}
+
+func NewRedisLimiter(client *redis.Client) *RedisLimiter {
+	return &RedisLimiter{client: client}
+}
+
+func (l *RedisLimiter) Allow(ctx context.Context, key string, limit Limit) (bool, time.Duration, error) {
+	ctx, span := telemetry.StartCacheSpan(ctx, "EVALSHA", key)
+	result, err := takeScript.Run(ctx, l.client, []string{key}, limit.Rate, limit.Burst).Int64Slice()
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		return false, 0, err
+	}
+	return result[0] == 1, time.Duration(result[1]) * time.Millisecond, nil
+}
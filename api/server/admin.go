@@ -0,0 +1,57 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/alextebbs/counters/cache"
+	pbadmin "github.com/alextebbs/counters/pb/admin/v1"
+)
+
+type adminServer struct {
+	pbadmin.UnimplementedAdminServiceServer
+	warmer  *cache.Warmer
+	checker *cache.Checker
+}
+
+func (s *adminServer) WarmCache(req *pbadmin.AdminServiceWarmCacheRequest, stream pbadmin.AdminService_WarmCacheServer) error {
+	warmer := s.warmer.With(int(req.BatchSize), int(req.Concurrency))
+
+	// if the client goes away the stream context is cancelled, which stops the
+	// warm-up too, so a failed send only needs to stop further progress updates.
+	var sendErr error
+	p, err := warmer.Warm(stream.Context(), func(p cache.WarmProgress) {
+		if sendErr != nil {
+			return
+		}
+		sendErr = stream.Send(&pbadmin.AdminServiceWarmCacheResponse{
+			CountersWritten: p.Counters,
+			EventsWritten:   p.Events,
+		})
+		if sendErr != nil {
+			slog.WarnContext(stream.Context(), "Failed to send cache warm-up progress", "err", sendErr)
+		}
+	})
+	if err != nil {
+		return internalError(stream.Context(), "Failed to warm cache", err)
+	}
+
+	return stream.Send(&pbadmin.AdminServiceWarmCacheResponse{
+		CountersWritten: p.Counters,
+		EventsWritten:   p.Events,
+		Done:            true,
+	})
+}
+
+func (s *adminServer) CheckCache(ctx context.Context, req *pbadmin.AdminServiceCheckCacheRequest) (*pbadmin.AdminServiceCheckCacheResponse, error) {
+	result, err := s.checker.Check(ctx, req.Repair)
+	if err != nil {
+		return nil, internalError(ctx, "Failed to check cache", err)
+	}
+
+	return &pbadmin.AdminServiceCheckCacheResponse{
+		KeysChecked:  result.Checked,
+		Divergences:  result.Divergences,
+		KeysRepaired: result.Repaired,
+	}, nil
+}
@@ -0,0 +1,118 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+
+	"github.com/alextebbs/counters/auth"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	reflectionv1 "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	reflectionv1alpha "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+)
+
+// Services anyone can call without a token. Load balancers and k8s check
+// health without one, and reflection only describes the API, which is in the
+// repo anyway.
+var unauthenticatedServices = map[string]bool{
+	healthpb.Health_ServiceDesc.ServiceName:                    true,
+	reflectionv1.ServerReflection_ServiceDesc.ServiceName:      true,
+	reflectionv1alpha.ServerReflection_ServiceDesc.ServiceName: true,
+}
+
+// Checks the bearer token in the authorization metadata and puts who it
+// belongs to in the context for the handlers, see auth.FromContext.
+func authenticate(ctx context.Context, a auth.Authenticator, admins admins, fullMethod string) (context.Context, error) {
+	service, _ := splitMethodName(fullMethod)
+	if unauthenticatedServices[service] {
+		return ctx, nil
+	}
+
+	token, ok := bearerToken(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "missing bearer token in authorization metadata")
+	}
+
+	p, err := a.Authenticate(ctx, token)
+	if errors.Is(err, auth.ErrInvalidCredentials) {
+		// the reason is for us, not for whoever is trying tokens out
+		slog.InfoContext(ctx, "Rejected credentials", "method", fullMethod, "err", err)
+		return nil, status.Error(codes.Unauthenticated, "invalid bearer token")
+	}
+	if err != nil {
+		// API keys are looked up in the database, which might be down
+		slog.ErrorContext(ctx, "Failed to check credentials", "method", fullMethod, "err", err)
+		return nil, status.Error(codes.Unavailable, "couldn't check bearer token, try again later")
+	}
+
+	if err := checkAccess(p, fullMethod, admins); err != nil {
+		return nil, err
+	}
+	return auth.NewContext(ctx, p), nil
+}
+
+func bearerToken(ctx context.Context) (string, bool) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return "", false
+	}
+
+	scheme, token, ok := strings.Cut(values[0], " ")
+	if !ok || !strings.EqualFold(scheme, "bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+func authUnaryInterceptor(a auth.Authenticator, admins admins) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := authenticate(ctx, a, admins, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func authStreamInterceptor(a auth.Authenticator, admins admins) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticate(ss.Context(), a, admins, info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &contextServerStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// Who is calling, which is who counters are created for and whose roles are
+// checked, or "" when auth is disabled.
+func subjectFromContext(ctx context.Context) string {
+	if p, ok := auth.FromContext(ctx); ok {
+		return p.Subject
+	}
+	return ""
+}
+
+// The subjects who can call AdminService once auth is enabled. Nobody can when
+// it's empty, since repairing the cache or minting admin keys shouldn't be
+// open to every user who can sign in.
+type admins map[string]bool
+
+func newAdmins(subjects []string) admins {
+	a := make(admins, len(subjects))
+	for _, s := range subjects {
+		a[s] = true
+	}
+	return a
+}
+
+func (a admins) contains(subject string) bool {
+	return a[subject]
+}
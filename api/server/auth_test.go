@@ -0,0 +1,62 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alextebbs/counters/auth"
+	"github.com/alextebbs/counters/client"
+	"github.com/alextebbs/counters/store"
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+func TestAuth(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	authenticator, err := auth.NewJWTAuthenticator(auth.JWTOptions{HMACSecret: secret})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := newTestServer(t, Options{Store: store.NewMemoryStore(), Auth: authenticator})
+
+	sign := func(key []byte) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+			"sub": "alice",
+			"exp": time.Now().Add(time.Hour).Unix(),
+		}).SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+
+	tests := []struct {
+		name     string
+		token    string
+		wantCode codes.Code
+	}{
+		{name: "no token", wantCode: codes.Unauthenticated},
+		{name: "bad token", token: sign([]byte("not the secret, not the secret!!")), wantCode: codes.Unauthenticated},
+		{name: "good token", token: sign(secret)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := client.New(conn, client.Options{Token: tt.token, MaxRetries: -1})
+			_, err := c.Create(context.Background(), "coffee", "first cup")
+			if code := status.Code(err); code != tt.wantCode {
+				t.Errorf("Create returned %v, want code %v", err, tt.wantCode)
+			}
+		})
+	}
+
+	t.Run("health is exempt", func(t *testing.T) {
+		_, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{})
+		if err != nil {
+			t.Errorf("health check without a token failed: %v", err)
+		}
+	})
+}
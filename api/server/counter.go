@@ -0,0 +1,204 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/alextebbs/counters/cache"
+	pbcounter "github.com/alextebbs/counters/pb/counter/v1"
+	pbmember "github.com/alextebbs/counters/pb/member/v1"
+	"github.com/alextebbs/counters/store"
+)
+
+type counterServer struct {
+	pbcounter.UnimplementedCounterServiceServer
+	store   store.CounterStore
+	members store.MemberStore
+	cache   cache.Cache
+	// only used to count events for quotas
+	events store.EventStore
+	quotas Quotas
+	// which day the events quota is for, time.Now outside tests
+	now func() time.Time
+}
+
+func (s *counterServer) Create(ctx context.Context, req *pbcounter.CounterServiceCreateRequest) (*pbcounter.CounterServiceCreateResponse, error) {
+	owner := subjectFromContext(ctx)
+	if err := s.quotas.checkCounters(ctx, s.store, owner); err != nil {
+		return nil, err
+	}
+
+	// first, insert into the store
+	c, e, err := s.store.CreateCounter(ctx, owner, req.GetTitle(), req.GetEventTitle())
+	if err != nil {
+		return nil, storageError(ctx, "counter", "Failed to insert counter into database", err)
+	}
+	countersCreated.Inc()
+
+	// then cache both, failing that they're read through on the next Get
+	ctx = afterCommit(ctx)
+	err = s.cache.Set(ctx, "counter", cache.OwnerKey(owner, c.Id), c, 0)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to cache counter", "err", err)
+	}
+
+	err = s.cache.Set(ctx, "event", cache.OwnerKey(owner, e.Id), e, 0)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to cache event", "err", err)
+	}
+
+	return &pbcounter.CounterServiceCreateResponse{Counter: c}, nil
+}
+
+func (s *counterServer) Get(ctx context.Context, req *pbcounter.CounterServiceGetRequest) (*pbcounter.CounterServiceGetResponse, error) {
+	access, err := authorize(ctx, s.members, req.Id, pbmember.Role_ROLE_VIEWER)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := s.getCounter(ctx, access)
+	if err != nil {
+		return nil, storageError(ctx, "counter", "Failed to get counter from database", err)
+	}
+
+	return &pbcounter.CounterServiceGetResponse{Counter: c}, nil
+}
+
+func (s *counterServer) List(ctx context.Context, req *pbcounter.CounterServiceListRequest) (*pbcounter.CounterServiceListResponse, error) {
+	// First, find every counter the caller is a member of
+	accesses, err := s.members.ListAccess(ctx, subjectFromContext(ctx))
+	if err != nil {
+		return nil, storageError(ctx, "counter", "Failed to query database for counter IDs", err)
+	}
+
+	var ids []string
+	byID := make(map[string]*store.Access, len(accesses))
+	for _, a := range accesses {
+		if !keyAllowsCounter(ctx, a.CounterID) {
+			continue
+		}
+		ids = append(ids, a.CounterID)
+		byID[a.CounterID] = a
+	}
+
+	ids, nextPageToken, err := paginate(ids, req.PageSize, req.PageToken)
+	if err != nil {
+		return nil, err
+	}
+
+	var counters []*pbcounter.Counter
+
+	for _, id := range ids {
+		c, err := s.getCounter(ctx, byID[id])
+		if err != nil && ctx.Err() != nil {
+			return nil, storageError(ctx, "counter", "Failed to fetch counters during list iteration", err)
+		}
+		if err != nil {
+			// most likely deleted since we listed the IDs
+			slog.ErrorContext(ctx, "Failed to fetch counter from database during list iteration", "id", id, "err", err)
+			continue
+		}
+		counters = append(counters, c)
+	}
+
+	return &pbcounter.CounterServiceListResponse{
+		Counters:      counters,
+		NextPageToken: nextPageToken,
+	}, nil
+}
+
+// Gets a counter the caller has access to from the cache, or failing that
+// from the store, in which case it's cached so it's there for next time.
+func (s *counterServer) getCounter(ctx context.Context, access *store.Access) (*pbcounter.Counter, error) {
+	key := cache.OwnerKey(access.Owner, access.CounterID)
+
+	var c pbcounter.Counter
+	err := s.cache.Get(ctx, "counter", key, &c)
+	if err == nil {
+		return &c, nil
+	}
+	slog.DebugContext(ctx, "Counter not in cache, falling back to database", "id", access.CounterID, "err", err)
+
+	stored, err := s.store.GetCounter(ctx, access.CounterID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.cache.Set(ctx, "counter", key, stored, 0)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to cache counter", "err", err)
+	}
+
+	return stored, nil
+}
+
+func (s *counterServer) Increment(ctx context.Context, req *pbcounter.CounterServiceIncrementRequest) (*pbcounter.CounterServiceIncrementResponse, error) {
+	access, err := authorize(ctx, s.members, req.Id, pbmember.Role_ROLE_EDITOR)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.quotas.checkEvents(ctx, s.events, req.Id, s.now()); err != nil {
+		return nil, err
+	}
+
+	c, e, err := s.store.IncrementCounter(ctx, req.Id, subjectFromContext(ctx), req.Title)
+	if err != nil {
+		return nil, storageError(ctx, "counter", "Failed to increment counter in database", err)
+	}
+	countersIncremented.Inc()
+
+	// Now update the cache accordingly
+	ctx = afterCommit(ctx)
+	err = s.cache.Set(ctx, "counter", cache.OwnerKey(access.Owner, c.Id), c, 0)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to update cache for counter", "err", err)
+	}
+
+	err = s.cache.Set(ctx, "event", cache.OwnerKey(access.Owner, e.Id), e, 0)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to update cache for event", "err", err)
+	}
+
+	return &pbcounter.CounterServiceIncrementResponse{
+		Counter: c,
+		Event:   e,
+	}, nil
+}
+
+func (s *counterServer) Delete(ctx context.Context, req *pbcounter.CounterServiceDeleteRequest) (*pbcounter.CounterServiceDeleteResponse, error) {
+	access, err := authorize(ctx, s.members, req.Id, pbmember.Role_ROLE_OWNER)
+	if err != nil {
+		return nil, err
+	}
+
+	eventIDs, err := s.store.DeleteCounter(ctx, req.Id)
+	if err != nil {
+		return nil, storageError(ctx, "counter", "Failed to delete counter from database", err)
+	}
+	countersDeleted.Inc()
+
+	// Invalidate the cache for the counter
+	ctx = afterCommit(ctx)
+	err = s.cache.Del(ctx, "counter", cache.OwnerKey(access.Owner, req.Id))
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to delete counter from cache", "err", err)
+	}
+
+	// Invalidate the cache for associated events
+	for _, eventID := range eventIDs {
+		err = s.cache.Del(ctx, "event", cache.OwnerKey(access.Owner, eventID))
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to delete event from cache", "event_id", eventID, "err", err)
+		}
+	}
+
+	return &pbcounter.CounterServiceDeleteResponse{}, nil
+}
+
+// Once a change is committed the cache has to follow it, or it would serve the
+// old value until it's repaired, so cache writes mustn't be cancelled along
+// with the request. Redis' own timeouts still apply.
+func afterCommit(ctx context.Context) context.Context {
+	return context.WithoutCancel(ctx)
+}
@@ -0,0 +1,391 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alextebbs/counters/auth"
+	"github.com/alextebbs/counters/cache"
+	pbcounter "github.com/alextebbs/counters/pb/counter/v1"
+	pbevent "github.com/alextebbs/counters/pb/event/v1"
+	"github.com/alextebbs/counters/store"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// A Cache which keeps marshalled messages in a map, so tests can see what
+// the handlers cached.
+type testCache map[string][]byte
+
+func (c testCache) Get(ctx context.Context, keyPrefix, id string, message proto.Message) error {
+	b, ok := c[keyPrefix+":"+id]
+	if !ok {
+		return cache.ErrMiss
+	}
+	return proto.Unmarshal(b, message)
+}
+
+func (c testCache) Set(ctx context.Context, keyPrefix, id string, message proto.Message, expiration time.Duration) error {
+	b, err := proto.Marshal(message)
+	if err != nil {
+		return err
+	}
+	c[keyPrefix+":"+id] = b
+	return nil
+}
+
+func (c testCache) Del(ctx context.Context, keyPrefix, id string) error {
+	delete(c, keyPrefix+":"+id)
+	return nil
+}
+
+// A clock for the stores which only moves when told to.
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+type testEnv struct {
+	store    store.Store
+	cache    testCache
+	clock    *testClock
+	counters *counterServer
+	events   *eventServer
+	members  *memberServer
+	keys     *keyServer
+}
+
+// Every store the handlers are tested against, since they should all behave
+// the same.
+var testStores = []struct {
+	name string
+	new  func(t *testing.T, now func() time.Time) store.Store
+}{
+	{"memory", func(t *testing.T, now func() time.Time) store.Store {
+		s := store.NewMemoryStore()
+		s.SetClock(now)
+		return s
+	}},
+	{"sqlite", func(t *testing.T, now func() time.Time) store.Store {
+		db, err := store.OpenSQLite(filepath.Join(t.TempDir(), "counters.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		migrator, err := store.NewMigrator(db, "sqlite")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := migrator.Up(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		s := store.NewSQLiteStore(db)
+		s.SetClock(now)
+		return s
+	}},
+}
+
+func newTestEnv(t *testing.T, newStore func(t *testing.T, now func() time.Time) store.Store) *testEnv {
+	env := &testEnv{
+		cache: testCache{},
+		clock: &testClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	env.store = newStore(t, env.clock.Now)
+	env.counters = &counterServer{store: env.store, members: env.store, cache: env.cache, events: env.store, now: env.clock.Now}
+	env.events = &eventServer{store: env.store, members: env.store, cache: env.cache}
+	env.members = &memberServer{store: env.store, now: env.clock.Now}
+	env.keys = &keyServer{store: env.store, now: env.clock.Now}
+	return env
+}
+
+// Creates a counter and increments it once for each duration, advancing the
+// clock by that much first.
+func (env *testEnv) createCounter(t *testing.T, title string, increments ...time.Duration) *pbcounter.Counter {
+	t.Helper()
+	ctx := context.Background()
+
+	resp, err := env.counters.Create(ctx, &pbcounter.CounterServiceCreateRequest{Title: title, EventTitle: "created"})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	c := resp.Counter
+
+	for i, d := range increments {
+		env.clock.now = env.clock.now.Add(d)
+		resp, err := env.counters.Increment(ctx, &pbcounter.CounterServiceIncrementRequest{Id: c.Id, Title: fmt.Sprintf("increment %d", i+1)})
+		if err != nil {
+			t.Fatalf("Increment: %v", err)
+		}
+		c = resp.Counter
+	}
+	return c
+}
+
+const missingID = "00000000-0000-4000-8000-000000000000"
+
+func TestCounterGet(t *testing.T) {
+	tests := []struct {
+		name      string
+		cached    bool // whether the counter is still in the cache
+		id        func(c *pbcounter.Counter) string
+		wantCode  codes.Code
+		wantCount int32
+	}{
+		{name: "cached", cached: true, id: func(c *pbcounter.Counter) string { return c.Id }, wantCount: 2},
+		{name: "read through", id: func(c *pbcounter.Counter) string { return c.Id }, wantCount: 2},
+		{name: "missing", id: func(*pbcounter.Counter) string { return missingID }, wantCode: codes.NotFound},
+	}
+
+	for _, backend := range testStores {
+		for _, tt := range tests {
+			t.Run(backend.name+"/"+tt.name, func(t *testing.T) {
+				env := newTestEnv(t, backend.new)
+				c := env.createCounter(t, "coffee", time.Hour, time.Hour)
+				if !tt.cached {
+					delete(env.cache, "counter:"+cache.OwnerKey("", c.Id))
+				}
+
+				resp, err := env.counters.Get(context.Background(), &pbcounter.CounterServiceGetRequest{Id: tt.id(c)})
+				if code := status.Code(err); code != tt.wantCode {
+					t.Fatalf("Get returned %v, want code %v", err, tt.wantCode)
+				}
+				if err != nil {
+					return
+				}
+
+				if resp.Counter.Count != tt.wantCount {
+					t.Errorf("count = %d, want %d", resp.Counter.Count, tt.wantCount)
+				}
+				if _, ok := env.cache["counter:"+cache.OwnerKey("", c.Id)]; !ok {
+					t.Errorf("counter isn't cached after Get")
+				}
+			})
+		}
+	}
+}
+
+func TestCounterList(t *testing.T) {
+	tests := []struct {
+		name       string
+		titles     []string
+		deleted    int // how many of the counters to delete before listing
+		wantTitles []string
+	}{
+		{name: "empty"},
+		{name: "in creation order", titles: []string{"a", "b", "c"}, wantTitles: []string{"a", "b", "c"}},
+		{name: "without deleted", titles: []string{"a", "b", "c"}, deleted: 1, wantTitles: []string{"b", "c"}},
+	}
+
+	for _, backend := range testStores {
+		for _, tt := range tests {
+			t.Run(backend.name+"/"+tt.name, func(t *testing.T) {
+				env := newTestEnv(t, backend.new)
+				ctx := context.Background()
+
+				var ids []string
+				for _, title := range tt.titles {
+					ids = append(ids, env.createCounter(t, title).Id)
+				}
+				for _, id := range ids[:tt.deleted] {
+					if _, err := env.counters.Delete(ctx, &pbcounter.CounterServiceDeleteRequest{Id: id}); err != nil {
+						t.Fatalf("Delete: %v", err)
+					}
+				}
+
+				resp, err := env.counters.List(ctx, &pbcounter.CounterServiceListRequest{})
+				if err != nil {
+					t.Fatalf("List: %v", err)
+				}
+
+				var titles []string
+				for _, c := range resp.Counters {
+					titles = append(titles, c.Title)
+				}
+				if fmt.Sprint(titles) != fmt.Sprint(tt.wantTitles) {
+					t.Errorf("titles = %v, want %v", titles, tt.wantTitles)
+				}
+			})
+		}
+	}
+}
+
+func TestCounterIncrement(t *testing.T) {
+	tests := []struct {
+		name         string
+		increments   []time.Duration
+		missing      bool
+		wantCode     codes.Code
+		wantCount    int32
+		wantDuration time.Duration // of the last increment's event
+	}{
+		{name: "first increment", increments: []time.Duration{time.Minute}, wantCount: 1, wantDuration: time.Minute},
+		{name: "duration since previous event", increments: []time.Duration{time.Minute, time.Hour, 2 * time.Second}, wantCount: 3, wantDuration: 2 * time.Second},
+		{name: "missing counter", missing: true, wantCode: codes.NotFound},
+	}
+
+	for _, backend := range testStores {
+		for _, tt := range tests {
+			t.Run(backend.name+"/"+tt.name, func(t *testing.T) {
+				env := newTestEnv(t, backend.new)
+				ctx := context.Background()
+
+				id := missingID
+				if !tt.missing {
+					id = env.createCounter(t, "coffee", tt.increments[:len(tt.increments)-1]...).Id
+					env.clock.now = env.clock.now.Add(tt.increments[len(tt.increments)-1])
+				}
+
+				resp, err := env.counters.Increment(ctx, &pbcounter.CounterServiceIncrementRequest{Id: id, Title: "last"})
+				if code := status.Code(err); code != tt.wantCode {
+					t.Fatalf("Increment returned %v, want code %v", err, tt.wantCode)
+				}
+				if err != nil {
+					return
+				}
+
+				if resp.Counter.Count != tt.wantCount {
+					t.Errorf("count = %d, want %d", resp.Counter.Count, tt.wantCount)
+				}
+				if d := resp.Event.Duration.AsDuration(); d != tt.wantDuration {
+					t.Errorf("duration = %v, want %v", d, tt.wantDuration)
+				}
+				if !resp.Counter.Timestamp.AsTime().Equal(env.clock.now) {
+					t.Errorf("timestamp = %v, want %v", resp.Counter.Timestamp.AsTime(), env.clock.now)
+				}
+				if resp.Event.CounterId != id {
+					t.Errorf("event counter_id = %q, want %q", resp.Event.CounterId, id)
+				}
+
+				var cached pbcounter.Counter
+				if err := env.cache.Get(ctx, "counter", cache.OwnerKey("", id), &cached); err != nil || cached.Count != tt.wantCount {
+					t.Errorf("cached count = %d (%v), want %d", cached.Count, err, tt.wantCount)
+				}
+			})
+		}
+	}
+}
+
+func TestCounterDelete(t *testing.T) {
+	tests := []struct {
+		name     string
+		missing  bool
+		wantCode codes.Code
+	}{
+		{name: "counter and events"},
+		{name: "missing counter", missing: true, wantCode: codes.NotFound},
+	}
+
+	for _, backend := range testStores {
+		for _, tt := range tests {
+			t.Run(backend.name+"/"+tt.name, func(t *testing.T) {
+				env := newTestEnv(t, backend.new)
+				ctx := context.Background()
+
+				// a second counter whose events must survive
+				other := env.createCounter(t, "tea", time.Minute)
+
+				id := missingID
+				if !tt.missing {
+					id = env.createCounter(t, "coffee", time.Minute, time.Minute).Id
+				}
+
+				_, err := env.counters.Delete(ctx, &pbcounter.CounterServiceDeleteRequest{Id: id})
+				if code := status.Code(err); code != tt.wantCode {
+					t.Fatalf("Delete returned %v, want code %v", err, tt.wantCode)
+				}
+
+				if _, err := env.store.GetCounter(ctx, id); !errors.Is(err, store.ErrNotFound) {
+					t.Errorf("counter still in store after Delete: %v", err)
+				}
+				if ids, _ := env.store.ListEventIDs(ctx, id); len(ids) != 0 {
+					t.Errorf("%d events still in store after Delete", len(ids))
+				}
+				if ids, _ := env.store.ListEventIDs(ctx, other.Id); len(ids) != 2 {
+					t.Errorf("other counter has %d events, want 2", len(ids))
+				}
+
+				// only the other counter and its events are left in the cache
+				if len(env.cache) != 3 {
+					t.Errorf("cache has %d entries after Delete, want 3", len(env.cache))
+				}
+			})
+		}
+	}
+}
+
+// Nobody can see or change anyone else's counters, which look exactly like
+// ones that don't exist.
+func TestCounterOwners(t *testing.T) {
+	for _, backend := range testStores {
+		t.Run(backend.name, func(t *testing.T) {
+			env := newTestEnv(t, backend.new)
+			alice := auth.NewContext(context.Background(), &auth.Principal{Subject: "alice"})
+			bob := auth.NewContext(context.Background(), &auth.Principal{Subject: "bob"})
+
+			resp, err := env.counters.Create(alice, &pbcounter.CounterServiceCreateRequest{Title: "coffee", EventTitle: "first cup"})
+			if err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+			c := resp.Counter
+			if c.Owner != "alice" {
+				t.Errorf("owner = %q, want alice", c.Owner)
+			}
+			if _, err := env.counters.Create(bob, &pbcounter.CounterServiceCreateRequest{Title: "tea", EventTitle: "first cup"}); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+
+			calls := map[string]func(ctx context.Context) error{
+				"Get": func(ctx context.Context) error {
+					_, err := env.counters.Get(ctx, &pbcounter.CounterServiceGetRequest{Id: c.Id})
+					return err
+				},
+				"Increment": func(ctx context.Context) error {
+					_, err := env.counters.Increment(ctx, &pbcounter.CounterServiceIncrementRequest{Id: c.Id, Title: "stolen cup"})
+					return err
+				},
+				"events List": func(ctx context.Context) error {
+					_, err := env.events.List(ctx, &pbevent.EventServiceListRequest{Id: c.Id})
+					return err
+				},
+				"Delete": func(ctx context.Context) error {
+					_, err := env.counters.Delete(ctx, &pbcounter.CounterServiceDeleteRequest{Id: c.Id})
+					return err
+				},
+			}
+			for name, call := range calls {
+				if err := call(bob); status.Code(err) != codes.NotFound {
+					t.Errorf("%s of someone else's counter returned %v, want NotFound", name, err)
+				}
+			}
+
+			for ctx, want := range map[context.Context]string{alice: "coffee", bob: "tea"} {
+				list, err := env.counters.List(ctx, &pbcounter.CounterServiceListRequest{})
+				if err != nil {
+					t.Fatalf("List: %v", err)
+				}
+				if len(list.Counters) != 1 || list.Counters[0].Title != want {
+					t.Errorf("List for %s returned %v, want only %s", subjectFromContext(ctx), list.Counters, want)
+				}
+			}
+
+			// alice's counter is untouched
+			got, err := env.counters.Get(alice, &pbcounter.CounterServiceGetRequest{Id: c.Id})
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			if got.Counter.Count != 0 {
+				t.Errorf("count = %d after someone else's Increment, want 0", got.Counter.Count)
+			}
+		})
+	}
+}
@@ -0,0 +1,25 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc"
+)
+
+// Gives unary RPCs which arrive without a deadline one of timeout, so a client
+// which never gives up can't hold a database connection forever. The deadline
+// reaches postgres through the *Context calls and Redis through its socket
+// deadlines. Streams such as AdminService.WarmCache are expected to run for a
+// while, so they're left alone.
+func deadlineUnaryInterceptor(timeout time.Duration) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if _, ok := ctx.Deadline(); ok || timeout <= 0 {
+			return handler(ctx, req)
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		return handler(ctx, req)
+	}
+}
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/alextebbs/counters/store"
+	"github.com/lib/pq"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Postgres error codes we report as something other than Internal, see
+// https://www.postgresql.org/docs/current/errcodes-appendix.html
+const (
+	pqUniqueViolation           = "23505"
+	pqForeignKeyViolation       = "23503"
+	pqInvalidTextRepresentation = "22P02"
+)
+
+// Shorthand for a single errdetails.BadRequest field violation.
+func fieldViolation(field, description string) *errdetails.BadRequest_FieldViolation {
+	return &errdetails.BadRequest_FieldViolation{Field: field, Description: description}
+}
+
+// An InvalidArgument status listing every violation, or nil if there are
+// none, so handlers can collect violations and return the result directly.
+func invalidArgument(violations ...*errdetails.BadRequest_FieldViolation) error {
+	if len(violations) == 0 {
+		return nil
+	}
+
+	msg := fmt.Sprintf("invalid %s: %s", violations[0].Field, violations[0].Description)
+	if len(violations) > 1 {
+		msg = fmt.Sprintf("%s (and %d more)", msg, len(violations)-1)
+	}
+
+	st, err := status.New(codes.InvalidArgument, msg).WithDetails(&errdetails.BadRequest{FieldViolations: violations})
+	if err != nil {
+		return status.Error(codes.InvalidArgument, msg)
+	}
+	return st.Err()
+}
+
+// A ResourceExhausted status with details, along with an errdetails.RetryInfo
+// saying how long to wait unless retryAfter is 0.
+func resourceExhausted(msg string, retryAfter time.Duration, details ...protoadapt.MessageV1) error {
+	if retryAfter > 0 {
+		details = append(details, &errdetails.RetryInfo{RetryDelay: durationpb.New(retryAfter)})
+	}
+	st, err := status.New(codes.ResourceExhausted, msg).WithDetails(details...)
+	if err != nil {
+		return status.Error(codes.ResourceExhausted, msg)
+	}
+	return st.Err()
+}
+
+// Turns an error from a store, database/sql or lib/pq into a status for the
+// client. Missing rows become NotFound and unique violations AlreadyExists, naming
+// resource. Anything unexpected is logged with msg and returned as an Internal
+// status which doesn't leak the postgres error.
+func storageError(ctx context.Context, resource, msg string, err error) error {
+	if errors.Is(err, store.ErrNotFound) || errors.Is(err, sql.ErrNoRows) {
+		slog.DebugContext(ctx, msg, "err", err)
+		return status.Errorf(codes.NotFound, "%s not found", resource)
+	}
+
+	if errors.Is(err, context.Canceled) {
+		return status.Error(codes.Canceled, "request cancelled")
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return status.Error(codes.DeadlineExceeded, "deadline exceeded")
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		case pqUniqueViolation:
+			slog.InfoContext(ctx, msg, "err", err)
+			return status.Errorf(codes.AlreadyExists, "%s already exists", resource)
+		case pqForeignKeyViolation:
+			slog.InfoContext(ctx, msg, "err", err)
+			return status.Errorf(codes.FailedPrecondition, "%s refers to something which doesn't exist", resource)
+		case pqInvalidTextRepresentation:
+			// e.g. an id which isn't a valid uuid, so there can't be a row for it
+			slog.DebugContext(ctx, msg, "err", err)
+			return status.Errorf(codes.NotFound, "%s not found", resource)
+		}
+	}
+
+	return internalError(ctx, msg, err)
+}
+
+// Logs err with msg and returns an Internal status without any details.
+func internalError(ctx context.Context, msg string, err error) error {
+	slog.ErrorContext(ctx, msg, "err", err)
+	return status.Error(codes.Internal, "internal error")
+}
+
+// A safety net for errors which weren't turned into a status by a handler,
+// which gRPC would otherwise send to the client as Unknown with the raw
+// error message.
+func errorsUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	resp, err := handler(ctx, req)
+	return resp, toStatusError(ctx, info.FullMethod, err)
+}
+
+func errorsStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return toStatusError(ss.Context(), info.FullMethod, handler(srv, ss))
+}
+
+func toStatusError(ctx context.Context, method string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	if errors.Is(err, context.Canceled) {
+		return status.Error(codes.Canceled, "request cancelled")
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return status.Error(codes.DeadlineExceeded, "deadline exceeded")
+	}
+	return internalError(ctx, "Unhandled error in "+method, err)
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/alextebbs/counters/cache"
+	pbevent "github.com/alextebbs/counters/pb/event/v1"
+	pbmember "github.com/alextebbs/counters/pb/member/v1"
+	"github.com/alextebbs/counters/store"
+)
+
+type eventServer struct {
+	pbevent.UnimplementedEventServiceServer
+	store   store.EventStore
+	members store.MemberStore
+	cache   cache.Cache
+}
+
+func (s *eventServer) List(ctx context.Context, req *pbevent.EventServiceListRequest) (*pbevent.EventServiceListResponse, error) {
+	access, err := authorize(ctx, s.members, req.Id, pbmember.Role_ROLE_VIEWER)
+	if err != nil {
+		return nil, err
+	}
+
+	ids, err := s.store.ListEventIDs(ctx, req.Id)
+	if err != nil {
+		return nil, storageError(ctx, "event", "Failed to query database for events", err)
+	}
+
+	ids, nextPageToken, err := paginate(ids, req.PageSize, req.PageToken)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []*pbevent.Event
+
+	for _, id := range ids {
+		var e pbevent.Event
+		err := s.cache.Get(ctx, "event", cache.OwnerKey(access.Owner, id), &e)
+		if err == nil {
+			events = append(events, &e)
+			continue
+		}
+
+		stored, err := s.store.GetEvent(ctx, id)
+		if err != nil {
+			return nil, storageError(ctx, "event", "Failed to fetch event from database during list iteration", err)
+		}
+		events = append(events, stored)
+
+		err = s.cache.Set(ctx, "event", cache.OwnerKey(access.Owner, stored.Id), stored, 0)
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to cache event", "err", err)
+		}
+	}
+
+	return &pbevent.EventServiceListResponse{
+		Events:        events,
+		NextPageToken: nextPageToken,
+	}, nil
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alextebbs/counters/cache"
+	pbevent "github.com/alextebbs/counters/pb/event/v1"
+)
+
+func TestEventList(t *testing.T) {
+	tests := []struct {
+		name          string
+		increments    []time.Duration
+		uncached      bool // whether to empty the cache before listing
+		otherCounter  bool // list a counter other than the one incremented
+		wantTitles    []string
+		wantDurations []time.Duration
+	}{
+		{
+			name:          "only the first event",
+			wantTitles:    []string{"created"},
+			wantDurations: []time.Duration{0},
+		},
+		{
+			name:          "in creation order",
+			increments:    []time.Duration{time.Minute, time.Hour},
+			wantTitles:    []string{"created", "increment 1", "increment 2"},
+			wantDurations: []time.Duration{0, time.Minute, time.Hour},
+		},
+		{
+			name:          "read through",
+			increments:    []time.Duration{time.Minute},
+			uncached:      true,
+			wantTitles:    []string{"created", "increment 1"},
+			wantDurations: []time.Duration{0, time.Minute},
+		},
+		{
+			name:         "other counter",
+			increments:   []time.Duration{time.Minute},
+			otherCounter: true,
+			wantTitles:   []string{"created"},
+			// the other counter is created after the first one's increment
+			wantDurations: []time.Duration{0},
+		},
+	}
+
+	for _, backend := range testStores {
+		for _, tt := range tests {
+			t.Run(backend.name+"/"+tt.name, func(t *testing.T) {
+				env := newTestEnv(t, backend.new)
+				ctx := context.Background()
+
+				c := env.createCounter(t, "coffee", tt.increments...)
+				if tt.otherCounter {
+					c = env.createCounter(t, "tea")
+				}
+				if tt.uncached {
+					for key := range env.cache {
+						delete(env.cache, key)
+					}
+				}
+
+				resp, err := env.events.List(ctx, &pbevent.EventServiceListRequest{Id: c.Id})
+				if err != nil {
+					t.Fatalf("List: %v", err)
+				}
+
+				if len(resp.Events) != len(tt.wantTitles) {
+					t.Fatalf("got %d events, want %d", len(resp.Events), len(tt.wantTitles))
+				}
+				for i, e := range resp.Events {
+					if e.Title != tt.wantTitles[i] {
+						t.Errorf("event %d title = %q, want %q", i, e.Title, tt.wantTitles[i])
+					}
+					if d := e.Duration.AsDuration(); d != tt.wantDurations[i] {
+						t.Errorf("event %d duration = %v, want %v", i, d, tt.wantDurations[i])
+					}
+					if e.CounterId != c.Id {
+						t.Errorf("event %d counter_id = %q, want %q", i, e.CounterId, c.Id)
+					}
+					if _, ok := env.cache["event:"+cache.OwnerKey("", e.Id)]; !ok {
+						t.Errorf("event %d isn't cached after List", i)
+					}
+				}
+			})
+		}
+	}
+}
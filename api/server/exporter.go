@@ -0,0 +1,230 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/alextebbs/counters/cache"
+	"github.com/alextebbs/counters/internal/telemetry"
+	pbcounter "github.com/alextebbs/counters/pb/counter/v1"
+	"github.com/alextebbs/counters/store"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/protobuf/proto"
+)
+
+const exporterBatchSize = 500
+
+var (
+	counterCountDesc = prometheus.NewDesc(
+		"counter_count",
+		"Number of times the counter has been incremented.",
+		[]string{"counter_id", "title"}, nil,
+	)
+	counterSecondsSinceLastEventDesc = prometheus.NewDesc(
+		"counter_seconds_since_last_event",
+		"Seconds since the counter was last incremented, or created if it never has been.",
+		[]string{"counter_id", "title"}, nil,
+	)
+)
+
+// Publishes the counters themselves as gauges, so they can be alerted on like
+// any other metric. Scrapes are served from the counter:* entries in Redis
+// rather than scanning postgres every time, so counters only show up once
+// they've been cached (see cache.Warmer).
+type CounterExporter struct {
+	db         *sql.DB
+	redis      *cache.RedisService
+	defaultTag string
+	tagTTL     time.Duration
+	timeout    time.Duration
+
+	mu   sync.Mutex
+	tags map[string]taggedCounters
+}
+
+// The cache keys of the counters with a tag, as of loadedAt.
+type taggedCounters struct {
+	keys     []string
+	loadedAt time.Time
+}
+
+func NewCounterExporter(db *sql.DB, redis *cache.RedisService, defaultTag string, tagTTL, timeout time.Duration) *CounterExporter {
+	return &CounterExporter{
+		db:         db,
+		redis:      redis,
+		defaultTag: defaultTag,
+		tagTTL:     tagTTL,
+		timeout:    timeout,
+		tags:       map[string]taggedCounters{},
+	}
+}
+
+// ServeHTTP serves the gauges for every cached counter, or only the counters
+// with the tag given by the tag query parameter, falling back to the
+// configured default tag.
+func (e *CounterExporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	tag := r.URL.Query().Get("tag")
+	if tag == "" {
+		tag = e.defaultTag
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(&counterCollector{exporter: e, ctx: r.Context(), tag: tag})
+
+	promhttp.HandlerFor(registry, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+}
+
+// A prometheus.Collector for a single scrape.
+type counterCollector struct {
+	exporter *CounterExporter
+	ctx      context.Context
+	tag      string
+}
+
+func (c *counterCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- counterCountDesc
+	ch <- counterSecondsSinceLastEventDesc
+}
+
+func (c *counterCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(c.ctx, c.exporter.timeout)
+	defer cancel()
+
+	now := time.Now()
+	err := c.exporter.eachCounter(ctx, c.tag, func(counter *pbcounter.Counter) {
+		ch <- prometheus.MustNewConstMetric(counterCountDesc, prometheus.GaugeValue,
+			float64(counter.Count), counter.Id, counter.Title)
+		ch <- prometheus.MustNewConstMetric(counterSecondsSinceLastEventDesc, prometheus.GaugeValue,
+			now.Sub(counter.Timestamp.AsTime()).Seconds(), counter.Id, counter.Title)
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to collect counters for export", "err", err)
+		ch <- prometheus.NewInvalidMetric(counterCountDesc, err)
+	}
+}
+
+// Calls fn with every cached counter, or every counter with tag.
+func (e *CounterExporter) eachCounter(ctx context.Context, tag string, fn func(*pbcounter.Counter)) error {
+	if tag != "" {
+		keys, err := e.taggedCounterKeys(ctx, tag)
+		if err != nil {
+			return err
+		}
+		return e.emitBatch(ctx, keys, true, fn)
+	}
+
+	// SCAN can return the same key more than once, and prometheus rejects
+	// duplicate series.
+	seen := map[string]bool{}
+	keys := make([]string, 0, exporterBatchSize)
+	err := e.redis.Scan(ctx, "counter", func(key string) error {
+		if seen[key] {
+			return nil
+		}
+		seen[key] = true
+		keys = append(keys, key)
+		if len(keys) < exporterBatchSize {
+			return nil
+		}
+		err := e.emitBatch(ctx, keys, false, fn)
+		keys = keys[:0]
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return e.emitBatch(ctx, keys, false, fn)
+}
+
+// Reads keys, from cache.OwnerKey, from the cache in batches. If readThrough
+// is true counters which aren't cached yet are read from postgres and cached,
+// like counterServer.Get.
+func (e *CounterExporter) emitBatch(ctx context.Context, keys []string, readThrough bool, fn func(*pbcounter.Counter)) error {
+	for start := 0; start < len(keys); start += exporterBatchSize {
+		batch := keys[start:min(start+exporterBatchSize, len(keys))]
+
+		cached, err := e.redis.GetMany(ctx, "counter", batch, func() proto.Message { return &pbcounter.Counter{} })
+		if err != nil {
+			return err
+		}
+
+		for _, key := range batch {
+			// keys cached before counters had owners, which the handlers
+			// never read, so they're stale and would duplicate the series of
+			// the same counter under its owner
+			owner, id, ok := cache.SplitOwnerKey(key)
+			if !ok {
+				continue
+			}
+			if m, ok := cached[key]; ok {
+				fn(m.(*pbcounter.Counter))
+				continue
+			}
+			if !readThrough {
+				continue
+			}
+
+			queryCtx, span := telemetry.StartQuerySpan(ctx, "SELECT", "counters")
+			c, err := store.ScanCounter(e.db.QueryRowContext(queryCtx, "SELECT id, title, count, timestamp, owner FROM counters WHERE id = $1 AND owner = $2", id, owner))
+			telemetry.EndSpan(span, err)
+			if err == sql.ErrNoRows {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			fn(c)
+
+			if err := e.redis.Set(ctx, "counter", key, c, 0); err != nil {
+				slog.ErrorContext(ctx, "Failed to cache counter in Redis", "err", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// The cache keys of the counters with tag. These are kept for e.tagTTL so
+// scrapes don't query postgres every time.
+func (e *CounterExporter) taggedCounterKeys(ctx context.Context, tag string) ([]string, error) {
+	e.mu.Lock()
+	tagged, ok := e.tags[tag]
+	e.mu.Unlock()
+
+	if ok && time.Since(tagged.loadedAt) < e.tagTTL {
+		return tagged.keys, nil
+	}
+
+	ctx, span := telemetry.StartQuerySpan(ctx, "SELECT", "tags")
+	rows, err := e.db.QueryContext(ctx, "SELECT DISTINCT counters.id, counters.owner FROM tags JOIN counters ON counters.id = tags.counter_id WHERE tags.title = $1", tag)
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to query database for tagged counters", "tag", tag, "err", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var id, owner string
+		if err := rows.Scan(&id, &owner); err != nil {
+			return nil, err
+		}
+		keys = append(keys, cache.OwnerKey(owner, id))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	e.tags[tag] = taggedCounters{keys: keys, loadedAt: time.Now()}
+	e.mu.Unlock()
+
+	return keys, nil
+}
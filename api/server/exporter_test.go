@@ -0,0 +1,54 @@
+package server
+
+import (
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alextebbs/counters/cache"
+	pbcounter "github.com/alextebbs/counters/pb/counter/v1"
+	"github.com/alextebbs/counters/store"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+)
+
+func TestExporterSkipsLegacyKeys(t *testing.T) {
+	ctx := context.Background()
+	db, err := store.OpenSQLite(filepath.Join(t.TempDir(), "counters.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	rs := cache.NewRedisService(redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()}))
+	t.Cleanup(func() { rs.Close() })
+
+	counter := &pbcounter.Counter{Id: "coffee", Title: "coffee", Count: 3, Owner: "alice"}
+	if err := rs.Set(ctx, "counter", cache.OwnerKey("alice", counter.Id), counter, 0); err != nil {
+		t.Fatal(err)
+	}
+	// the same counter, cached before it had an owner and not since
+	legacy := &pbcounter.Counter{Id: "coffee", Title: "coffee", Count: 1}
+	if err := rs.Set(ctx, "counter", legacy.Id, legacy, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	NewCounterExporter(db, rs, "", time.Minute, time.Second).ServeHTTP(w, httptest.NewRequest("GET", "/metrics/counters", nil))
+	if w.Code != 200 {
+		t.Fatalf("scrape returned %d: %s", w.Code, w.Body)
+	}
+
+	var series []string
+	for _, line := range strings.Split(w.Body.String(), "\n") {
+		if strings.HasPrefix(line, "counter_count{") {
+			series = append(series, line)
+		}
+	}
+	want := `counter_count{counter_id="coffee",title="coffee"} 3`
+	if len(series) != 1 || series[0] != want {
+		t.Errorf("exported %q, want only %q", series, want)
+	}
+}
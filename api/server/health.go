@@ -0,0 +1,208 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	pbadmin "github.com/alextebbs/counters/pb/admin/v1"
+	pbcounter "github.com/alextebbs/counters/pb/counter/v1"
+	pbevent "github.com/alextebbs/counters/pb/event/v1"
+	pbkey "github.com/alextebbs/counters/pb/key/v1"
+	pbmember "github.com/alextebbs/counters/pb/member/v1"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const (
+	DependencyDatabase = "database" // postgres or SQLite, whichever the server uses
+	DependencyRedis    = "redis"
+)
+
+// The dependencies each service needs in order to be SERVING. "" is the
+// server as a whole, which is what readiness is based on. Redis is only a
+// cache for CounterService and EventService, so they keep serving from
+// the database when it's down, but AdminService is all about the cache.
+var serviceDependencies = map[string][]string{
+	"": {DependencyDatabase},
+	pbcounter.CounterService_ServiceDesc.ServiceName: {DependencyDatabase},
+	pbevent.EventService_ServiceDesc.ServiceName:     {DependencyDatabase},
+	pbmember.MemberService_ServiceDesc.ServiceName:   {DependencyDatabase},
+	pbkey.KeyService_ServiceDesc.ServiceName:         {DependencyDatabase},
+	pbadmin.AdminService_ServiceDesc.ServiceName:     {DependencyDatabase, DependencyRedis},
+}
+
+// A health check for a single dependency, such as (*sql.DB).PingContext.
+type HealthCheck func(ctx context.Context) error
+
+// Periodically runs a check for each dependency and flips the per-service
+// statuses of a grpc.health.v1 server to match. It also serves the same
+// information over HTTP for k8s probes.
+type HealthProber struct {
+	server   *health.Server
+	probes   map[string]HealthCheck
+	services map[string][]string // the entries of serviceDependencies which can be checked
+	interval time.Duration
+	timeout  time.Duration
+
+	mu       sync.RWMutex
+	checks   map[string]error // last result for each dependency, nil when healthy
+	probed   bool
+	draining bool
+}
+
+// NewHealthProber reports on the services whose dependencies all have a
+// probe, the rest aren't registered when a dependency isn't in use.
+func NewHealthProber(server *health.Server, probes map[string]HealthCheck, interval, timeout time.Duration) *HealthProber {
+	services := map[string][]string{}
+	for service, dependencies := range serviceDependencies {
+		covered := true
+		for _, dependency := range dependencies {
+			if _, ok := probes[dependency]; !ok {
+				covered = false
+			}
+		}
+		if covered {
+			services[service] = dependencies
+			// nothing is ready until the first probe has run
+			server.SetServingStatus(service, healthpb.HealthCheckResponse_NOT_SERVING)
+		}
+	}
+
+	return &HealthProber{
+		server:   server,
+		probes:   probes,
+		services: services,
+		interval: interval,
+		timeout:  timeout,
+		checks:   map[string]error{},
+	}
+}
+
+// Run probes immediately and then every p.interval until ctx is done.
+func (p *HealthProber) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.probe(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Drain marks every service NOT_SERVING for good. Probes that are still
+// running can no longer change that.
+func (p *HealthProber) Drain() {
+	p.mu.Lock()
+	p.draining = true
+	p.mu.Unlock()
+
+	p.server.Shutdown()
+}
+
+func (p *HealthProber) probe(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	var checksMu sync.Mutex
+	checks := map[string]error{}
+	for dependency, check := range p.probes {
+		wg.Add(1)
+		go func(dependency string, check HealthCheck) {
+			defer wg.Done()
+			err := check(ctx)
+			checksMu.Lock()
+			checks[dependency] = err
+			checksMu.Unlock()
+		}(dependency, check)
+	}
+	wg.Wait()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for dependency, err := range checks {
+		prev, seen := p.checks[dependency]
+		if err != nil && (!seen || prev == nil) {
+			slog.WarnContext(ctx, "Health check failed", "dependency", dependency, "err", err)
+		} else if err == nil && seen && prev != nil {
+			slog.InfoContext(ctx, "Health check recovered", "dependency", dependency)
+		}
+	}
+	p.checks = checks
+	p.probed = true
+
+	for service, dependencies := range p.services {
+		status := healthpb.HealthCheckResponse_SERVING
+		for _, dependency := range dependencies {
+			if checks[dependency] != nil {
+				status = healthpb.HealthCheckResponse_NOT_SERVING
+			}
+		}
+		// once draining, health.Server ignores this
+		p.server.SetServingStatus(service, status)
+	}
+}
+
+// Whether the server should receive traffic, along with the latest result of
+// each check for humans to look at.
+func (p *HealthProber) ready() (bool, []string) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	ready := p.probed && !p.draining
+	var lines []string
+
+	if p.draining {
+		lines = append(lines, "server: draining")
+	}
+	if !p.probed {
+		lines = append(lines, "server: waiting for first health check")
+	}
+
+	for dependency, err := range p.checks {
+		if err != nil {
+			lines = append(lines, fmt.Sprintf("%s: %v", dependency, err))
+		} else {
+			lines = append(lines, fmt.Sprintf("%s: ok", dependency))
+		}
+	}
+	for _, dependency := range serviceDependencies[""] {
+		if p.checks[dependency] != nil {
+			ready = false
+		}
+	}
+
+	sort.Strings(lines)
+	return ready, lines
+}
+
+// /healthz is liveness: the process is up and serving HTTP, which is all it
+// checks, since restarting the pod won't fix postgres being down. /readyz is
+// readiness: the dependencies the server needs are healthy and it isn't
+// draining.
+func (p *HealthProber) RegisterHandlers(mux *http.ServeMux) {
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		ready, lines := p.ready()
+		if !ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		for _, line := range lines {
+			fmt.Fprintln(w, line)
+		}
+	})
+}
@@ -0,0 +1,181 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/alextebbs/counters/auth"
+	pbadmin "github.com/alextebbs/counters/pb/admin/v1"
+	pbcounter "github.com/alextebbs/counters/pb/counter/v1"
+	pbevent "github.com/alextebbs/counters/pb/event/v1"
+	pbkey "github.com/alextebbs/counters/pb/key/v1"
+	pbmember "github.com/alextebbs/counters/pb/member/v1"
+	"github.com/alextebbs/counters/store"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Starts every API key's secret, so they can be told apart from JWTs, and
+// spotted by secret scanners.
+const keySecretPrefix = "ck_"
+
+// last_used_at is only written when it's at least this old, rather than on
+// every call.
+const keyTouchInterval = time.Minute
+
+// The scope an API key needs for each method. Anything else can only be
+// called by users themselves, so a leaked key can't be used to delete or share
+// counters, or to make more keys. AdminService needs SCOPE_ADMIN, see
+// checkAccess.
+var methodScopes = map[string]pbkey.Scope{
+	pbcounter.CounterService_Get_FullMethodName:       pbkey.Scope_SCOPE_READ,
+	pbcounter.CounterService_List_FullMethodName:      pbkey.Scope_SCOPE_READ,
+	pbevent.EventService_Get_FullMethodName:           pbkey.Scope_SCOPE_READ,
+	pbevent.EventService_List_FullMethodName:          pbkey.Scope_SCOPE_READ,
+	pbmember.MemberService_List_FullMethodName:        pbkey.Scope_SCOPE_READ,
+	pbcounter.CounterService_Increment_FullMethodName: pbkey.Scope_SCOPE_INCREMENT,
+}
+
+type keyServer struct {
+	pbkey.UnimplementedKeyServiceServer
+	store  store.Store
+	admins admins
+	now    func() time.Time
+}
+
+func (s *keyServer) Create(ctx context.Context, req *pbkey.KeyServiceCreateRequest) (*pbkey.KeyServiceCreateResponse, error) {
+	subject := subjectFromContext(ctx)
+	if slices.Contains(req.Scopes, pbkey.Scope_SCOPE_ADMIN) && !s.admins.contains(subject) {
+		return nil, status.Error(codes.PermissionDenied, "only admins can create keys with SCOPE_ADMIN")
+	}
+	for _, id := range req.CounterIds {
+		if _, err := authorize(ctx, s.store, id, pbmember.Role_ROLE_VIEWER); err != nil {
+			return nil, err
+		}
+	}
+
+	secret, err := newKeySecret()
+	if err != nil {
+		return nil, internalError(ctx, "Failed to generate API key", err)
+	}
+
+	key := &pbkey.Key{
+		Name:       req.Name,
+		Subject:    subject,
+		Scopes:     req.Scopes,
+		CounterIds: req.CounterIds,
+	}
+	if req.Ttl != nil {
+		key.ExpiresAt = timestamppb.New(s.now().Add(req.Ttl.AsDuration()))
+	}
+
+	key, err = s.store.CreateKey(ctx, hashSecret(secret), key)
+	if err != nil {
+		return nil, storageError(ctx, "key", "Failed to insert API key into database", err)
+	}
+	slog.InfoContext(ctx, "Created API key", "key_id", key.Id, "scopes", key.Scopes)
+
+	return &pbkey.KeyServiceCreateResponse{Key: key, Secret: secret}, nil
+}
+
+func (s *keyServer) List(ctx context.Context, req *pbkey.KeyServiceListRequest) (*pbkey.KeyServiceListResponse, error) {
+	keys, err := s.store.ListKeys(ctx, subjectFromContext(ctx))
+	if err != nil {
+		return nil, storageError(ctx, "key", "Failed to query database for API keys", err)
+	}
+	return &pbkey.KeyServiceListResponse{Keys: keys}, nil
+}
+
+func (s *keyServer) Revoke(ctx context.Context, req *pbkey.KeyServiceRevokeRequest) (*pbkey.KeyServiceRevokeResponse, error) {
+	if err := s.store.DeleteKey(ctx, subjectFromContext(ctx), req.Id); err != nil {
+		return nil, storageError(ctx, "key", "Failed to delete API key from database", err)
+	}
+	slog.InfoContext(ctx, "Revoked API key", "key_id", req.Id)
+	return &pbkey.KeyServiceRevokeResponse{}, nil
+}
+
+// Authenticates API keys, handing every other token to next.
+type keyAuthenticator struct {
+	keys store.KeyStore
+	next auth.Authenticator
+	now  func() time.Time
+}
+
+func (a *keyAuthenticator) Authenticate(ctx context.Context, token string) (*auth.Principal, error) {
+	if !strings.HasPrefix(token, keySecretPrefix) {
+		return a.next.Authenticate(ctx, token)
+	}
+
+	key, err := a.keys.GetKey(ctx, hashSecret(token))
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, fmt.Errorf("%w: unknown API key", auth.ErrInvalidCredentials)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := a.now()
+	if key.ExpiresAt != nil && !now.Before(key.ExpiresAt.AsTime()) {
+		return nil, fmt.Errorf("%w: API key %s expired at %s", auth.ErrInvalidCredentials, key.Id, key.ExpiresAt.AsTime())
+	}
+
+	if key.LastUsedAt == nil || now.Sub(key.LastUsedAt.AsTime()) >= keyTouchInterval {
+		// the key still works if this fails, it's only for its owner's benefit
+		if err := a.keys.TouchKey(ctx, key.Id, now); err != nil {
+			slog.WarnContext(ctx, "Failed to record API key use", "key_id", key.Id, "err", err)
+		}
+	}
+
+	return &auth.Principal{Subject: key.Subject, Key: key}, nil
+}
+
+// Checks the caller can call fullMethod at all, before it's handled. Only
+// admins can call AdminService, and API keys need the scope for the method.
+func checkAccess(p *auth.Principal, fullMethod string, admins admins) error {
+	service, method := splitMethodName(fullMethod)
+
+	if service == pbadmin.AdminService_ServiceDesc.ServiceName {
+		if !admins.contains(p.Subject) || (p.Key != nil && !slices.Contains(p.Key.Scopes, pbkey.Scope_SCOPE_ADMIN)) {
+			return status.Error(codes.PermissionDenied, "only admins can call AdminService")
+		}
+		return nil
+	}
+	if p.Key == nil {
+		return nil
+	}
+
+	scope, ok := methodScopes[fullMethod]
+	if !ok {
+		return status.Errorf(codes.PermissionDenied, "API keys can't call %s.%s", service, method)
+	}
+	if !slices.Contains(p.Key.Scopes, scope) {
+		return status.Errorf(codes.PermissionDenied, "API key doesn't have %s", scope)
+	}
+	return nil
+}
+
+// Whether the caller's API key, if they used one, can be used with a counter.
+func keyAllowsCounter(ctx context.Context, counterID string) bool {
+	p, ok := auth.FromContext(ctx)
+	if !ok || p.Key == nil || len(p.Key.CounterIds) == 0 {
+		return true
+	}
+	return slices.Contains(p.Key.CounterIds, counterID)
+}
+
+// A random secret with 256 bits of entropy.
+func newKeySecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return keySecretPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,256 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alextebbs/counters/auth"
+	"github.com/alextebbs/counters/client"
+	pbadmin "github.com/alextebbs/counters/pb/admin/v1"
+	pbcounter "github.com/alextebbs/counters/pb/counter/v1"
+	pbevent "github.com/alextebbs/counters/pb/event/v1"
+	pbkey "github.com/alextebbs/counters/pb/key/v1"
+	pbmember "github.com/alextebbs/counters/pb/member/v1"
+	"github.com/alextebbs/counters/store"
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Makes a ctx for calls made with key, as the auth interceptor would.
+func withKey(key *pbkey.Key) context.Context {
+	return auth.NewContext(context.Background(), &auth.Principal{Subject: key.Subject, Key: key})
+}
+
+// Stands in for the JWT authenticator behind keyAuthenticator.
+type jwtOnly struct{}
+
+func (jwtOnly) Authenticate(ctx context.Context, token string) (*auth.Principal, error) {
+	return &auth.Principal{Subject: "jwt:" + token}, nil
+}
+
+func TestKeyAuthenticate(t *testing.T) {
+	for _, backend := range testStores {
+		t.Run(backend.name, func(t *testing.T) {
+			env := newTestEnv(t, backend.new)
+			a := &keyAuthenticator{keys: env.store, next: jwtOnly{}, now: env.clock.Now}
+			ctx := context.Background()
+
+			created, err := env.keys.Create(as("alice"), &pbkey.KeyServiceCreateRequest{
+				Name:   "cron",
+				Scopes: []pbkey.Scope{pbkey.Scope_SCOPE_INCREMENT},
+				Ttl:    durationpb.New(time.Hour),
+			})
+			if err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+
+			p, err := a.Authenticate(ctx, created.Secret)
+			if err != nil {
+				t.Fatalf("Authenticate: %v", err)
+			}
+			if p.Subject != "alice" || p.Key.GetId() != created.Key.Id {
+				t.Errorf("got principal %v with key %v, want alice with key %s", p.Subject, p.Key, created.Key.Id)
+			}
+
+			// when it was last used is recorded for its owner
+			list, err := env.keys.List(as("alice"), &pbkey.KeyServiceListRequest{})
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			if len(list.Keys) != 1 || !list.Keys[0].LastUsedAt.AsTime().Equal(env.clock.now) {
+				t.Errorf("List returned %v, want the key last used at %v", list.Keys, env.clock.now)
+			}
+
+			// anything else is someone else's problem
+			if p, err := a.Authenticate(ctx, "eyJ.not.a.key"); err != nil || p.Subject != "jwt:eyJ.not.a.key" {
+				t.Errorf("Authenticate with a JWT returned %v, %v, want it passed on", p, err)
+			}
+			if _, err := a.Authenticate(ctx, keySecretPrefix+"made-up"); !errors.Is(err, auth.ErrInvalidCredentials) {
+				t.Errorf("Authenticate with an unknown key returned %v, want ErrInvalidCredentials", err)
+			}
+
+			env.clock.now = env.clock.now.Add(time.Hour)
+			if _, err := a.Authenticate(ctx, created.Secret); !errors.Is(err, auth.ErrInvalidCredentials) {
+				t.Errorf("Authenticate with an expired key returned %v, want ErrInvalidCredentials", err)
+			}
+
+			// only its owner can revoke it
+			if _, err := env.keys.Revoke(as("bob"), &pbkey.KeyServiceRevokeRequest{Id: created.Key.Id}); status.Code(err) != codes.NotFound {
+				t.Errorf("bob's Revoke returned %v, want NotFound", err)
+			}
+			if _, err := env.keys.Revoke(as("alice"), &pbkey.KeyServiceRevokeRequest{Id: created.Key.Id}); err != nil {
+				t.Fatalf("Revoke: %v", err)
+			}
+			if _, err := a.Authenticate(ctx, created.Secret); !errors.Is(err, auth.ErrInvalidCredentials) {
+				t.Errorf("Authenticate with a revoked key returned %v, want ErrInvalidCredentials", err)
+			}
+		})
+	}
+}
+
+func TestKeyScopes(t *testing.T) {
+	read := []pbkey.Scope{pbkey.Scope_SCOPE_READ}
+	increment := []pbkey.Scope{pbkey.Scope_SCOPE_INCREMENT}
+	admin := []pbkey.Scope{pbkey.Scope_SCOPE_ADMIN}
+
+	tests := []struct {
+		name     string
+		method   string
+		scopes   []pbkey.Scope // nil when called without a key
+		subject  string
+		admins   []string // carol when nil
+		wantCode codes.Code
+	}{
+		{name: "read", method: pbcounter.CounterService_Get_FullMethodName, scopes: read},
+		{name: "read events", method: pbevent.EventService_List_FullMethodName, scopes: read},
+		{name: "increment", method: pbcounter.CounterService_Increment_FullMethodName, scopes: increment},
+		{name: "increment without scope", method: pbcounter.CounterService_Increment_FullMethodName, scopes: read, wantCode: codes.PermissionDenied},
+		{name: "read without scope", method: pbcounter.CounterService_List_FullMethodName, scopes: increment, wantCode: codes.PermissionDenied},
+		{name: "delete", method: pbcounter.CounterService_Delete_FullMethodName, scopes: admin, wantCode: codes.PermissionDenied},
+		{name: "share", method: pbmember.MemberService_Set_FullMethodName, scopes: admin, wantCode: codes.PermissionDenied},
+		{name: "make more keys", method: pbkey.KeyService_Create_FullMethodName, scopes: admin, wantCode: codes.PermissionDenied},
+		{name: "delete without a key", method: pbcounter.CounterService_Delete_FullMethodName},
+		{name: "admin", method: pbadmin.AdminService_WarmCache_FullMethodName, subject: "carol"},
+		{name: "admin with scope", method: pbadmin.AdminService_WarmCache_FullMethodName, scopes: admin, subject: "carol"},
+		{name: "admin without scope", method: pbadmin.AdminService_WarmCache_FullMethodName, scopes: read, subject: "carol", wantCode: codes.PermissionDenied},
+		{name: "not an admin", method: pbadmin.AdminService_WarmCache_FullMethodName, wantCode: codes.PermissionDenied},
+		{name: "not an admin with scope", method: pbadmin.AdminService_WarmCache_FullMethodName, scopes: admin, wantCode: codes.PermissionDenied},
+		{name: "no admins configured", method: pbadmin.AdminService_CheckCache_FullMethodName, admins: []string{}, wantCode: codes.PermissionDenied},
+		{name: "no admins configured with scope", method: pbadmin.AdminService_CheckCache_FullMethodName, scopes: admin, admins: []string{}, wantCode: codes.PermissionDenied},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &auth.Principal{Subject: "alice"}
+			if tt.subject != "" {
+				p.Subject = tt.subject
+			}
+			if tt.scopes != nil {
+				p.Key = &pbkey.Key{Subject: p.Subject, Scopes: tt.scopes}
+			}
+
+			admins := tt.admins
+			if admins == nil {
+				admins = []string{"carol"}
+			}
+
+			err := checkAccess(p, tt.method, newAdmins(admins))
+			if code := status.Code(err); code != tt.wantCode {
+				t.Errorf("checkAccess returned %v, want code %v", err, tt.wantCode)
+			}
+		})
+	}
+}
+
+func TestKeyCounters(t *testing.T) {
+	for _, backend := range testStores {
+		t.Run(backend.name, func(t *testing.T) {
+			env := newTestEnv(t, backend.new)
+			allowed := env.shareCounter(t, pbmember.Role_ROLE_UNSPECIFIED)
+			other := env.shareCounter(t, pbmember.Role_ROLE_UNSPECIFIED)
+
+			created, err := env.keys.Create(as("alice"), &pbkey.KeyServiceCreateRequest{
+				Scopes:     []pbkey.Scope{pbkey.Scope_SCOPE_READ, pbkey.Scope_SCOPE_INCREMENT},
+				CounterIds: []string{allowed.Id},
+			})
+			if err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+			ctx := withKey(created.Key)
+
+			if _, err := env.counters.Increment(ctx, &pbcounter.CounterServiceIncrementRequest{Id: allowed.Id, Title: "incident"}); err != nil {
+				t.Errorf("Increment of the allowed counter: %v", err)
+			}
+			if _, err := env.counters.Increment(ctx, &pbcounter.CounterServiceIncrementRequest{Id: other.Id, Title: "incident"}); status.Code(err) != codes.NotFound {
+				t.Errorf("Increment of another counter returned %v, want NotFound", err)
+			}
+
+			list, err := env.counters.List(ctx, &pbcounter.CounterServiceListRequest{})
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			if len(list.Counters) != 1 || list.Counters[0].Id != allowed.Id {
+				t.Errorf("List returned %v, want only the allowed counter", list.Counters)
+			}
+
+			// keys can't be given counters their owner can't see
+			_, err = env.keys.Create(as("bob"), &pbkey.KeyServiceCreateRequest{
+				Scopes:     []pbkey.Scope{pbkey.Scope_SCOPE_READ},
+				CounterIds: []string{allowed.Id},
+			})
+			if status.Code(err) != codes.NotFound {
+				t.Errorf("bob's Create for alice's counter returned %v, want NotFound", err)
+			}
+		})
+	}
+}
+
+func TestKeyCreateAdmin(t *testing.T) {
+	tests := []struct {
+		name     string
+		admins   []string
+		wantCode codes.Code
+	}{
+		{name: "admin", admins: []string{"alice"}},
+		{name: "not an admin", admins: []string{"carol"}, wantCode: codes.PermissionDenied},
+		{name: "no admins configured", wantCode: codes.PermissionDenied},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &keyServer{store: store.NewMemoryStore(), admins: newAdmins(tt.admins), now: time.Now}
+			_, err := s.Create(as("alice"), &pbkey.KeyServiceCreateRequest{Scopes: []pbkey.Scope{pbkey.Scope_SCOPE_ADMIN}})
+			if code := status.Code(err); code != tt.wantCode {
+				t.Errorf("Create returned %v, want code %v", err, tt.wantCode)
+			}
+		})
+	}
+}
+
+// A key made with a JWT, then used by the client in its place.
+func TestKeyServer(t *testing.T) {
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	authenticator, err := auth.NewJWTAuthenticator(auth.JWTOptions{HMACSecret: secret})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := newTestServer(t, Options{Store: store.NewMemoryStore(), Auth: authenticator})
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "alice",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}).SignedString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	alice := client.New(conn, client.Options{Token: token, MaxRetries: -1})
+
+	counter, err := alice.Create(ctx, "deploys", "first deploy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	created, err := pbkey.NewKeyServiceClient(conn).Create(
+		metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token),
+		&pbkey.KeyServiceCreateRequest{Name: "ci", Scopes: []pbkey.Scope{pbkey.Scope_SCOPE_INCREMENT}},
+	)
+	if err != nil {
+		t.Fatalf("Create key: %v", err)
+	}
+
+	ci := client.New(conn, client.Options{Token: created.Secret, MaxRetries: -1})
+	if _, _, err := ci.IncrementNow(ctx, counter.Id, "deploy"); err != nil {
+		t.Errorf("Increment with the key: %v", err)
+	}
+	if _, err := ci.Get(ctx, counter.Id); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Get without SCOPE_READ returned %v, want PermissionDenied", err)
+	}
+	if err := ci.Delete(ctx, counter.Id); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("Delete with a key returned %v, want PermissionDenied", err)
+	}
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/alextebbs/counters/auth"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Clients can set this to tie our logs to their own, otherwise one is
+// generated. Either way it's sent back in the response headers.
+const requestIDHeader = "x-request-id"
+
+type requestIDKey struct{}
+
+// The request ID assigned by the logging interceptor, or "" outside of a
+// request.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// NewLogHandler wraps h to add the request ID, the caller once they've been
+// authenticated, and the trace and span IDs when there is a span, from the
+// context passed to the logger. Everything should log with the *Context
+// variants so they make it into each line.
+func NewLogHandler(h slog.Handler) slog.Handler {
+	return contextHandler{h}
+}
+
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestIDFromContext(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if p, ok := auth.FromContext(ctx); ok {
+		r.AddAttrs(slog.String("principal", p.Subject))
+		if p.Key != nil {
+			r.AddAttrs(slog.String("api_key", p.Key.Id))
+		}
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(
+			slog.String("trace_id", sc.TraceID().String()),
+			slog.String("span_id", sc.SpanID().String()),
+		)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// Takes the request ID from the incoming metadata, or generates one, and
+// returns it to the client in the response headers.
+func withRequestID(ctx context.Context) context.Context {
+	var id string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(requestIDHeader); len(values) > 0 {
+			id = values[0]
+		}
+	}
+	if id == "" || len(id) > 128 {
+		id = newRequestID()
+	}
+
+	grpc.SetHeader(ctx, metadata.Pairs(requestIDHeader, id))
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+func logRPC(ctx context.Context, method string, start time.Time, err error) {
+	code := status.Code(err)
+	level := slog.LevelInfo
+	if err != nil {
+		level = slog.LevelWarn
+	}
+	slog.Log(ctx, level, "Finished call",
+		"method", method,
+		"code", code.String(),
+		"duration", time.Since(start),
+		"err", err,
+	)
+}
+
+func loggingUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	ctx = withRequestID(ctx)
+	start := time.Now()
+
+	resp, err := handler(ctx, req)
+	logRPC(ctx, info.FullMethod, start, err)
+
+	return resp, err
+}
+
+func loggingStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	ctx := withRequestID(ss.Context())
+	start := time.Now()
+
+	err := handler(srv, &contextServerStream{ServerStream: ss, ctx: ctx})
+	logRPC(ctx, info.FullMethod, start, err)
+
+	return err
+}
+
+// A grpc.ServerStream with a replaced context.
+type contextServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextServerStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	pbmember "github.com/alextebbs/counters/pb/member/v1"
+	"github.com/alextebbs/counters/store"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// How long invites can be accepted for when the request doesn't say.
+const defaultInviteTTL = 7 * 24 * time.Hour
+
+type memberServer struct {
+	pbmember.UnimplementedMemberServiceServer
+	store store.MemberStore
+	// where invite expiry times come from, time.Now outside tests
+	now func() time.Time
+}
+
+func (s *memberServer) List(ctx context.Context, req *pbmember.MemberServiceListRequest) (*pbmember.MemberServiceListResponse, error) {
+	if _, err := authorize(ctx, s.store, req.CounterId, pbmember.Role_ROLE_VIEWER); err != nil {
+		return nil, err
+	}
+
+	members, err := s.store.ListMembers(ctx, req.CounterId)
+	if err != nil {
+		return nil, storageError(ctx, "counter", "Failed to query database for members", err)
+	}
+	return &pbmember.MemberServiceListResponse{Members: members}, nil
+}
+
+func (s *memberServer) Set(ctx context.Context, req *pbmember.MemberServiceSetRequest) (*pbmember.MemberServiceSetResponse, error) {
+	if _, err := authorize(ctx, s.store, req.CounterId, pbmember.Role_ROLE_OWNER); err != nil {
+		return nil, err
+	}
+
+	m := &pbmember.Member{CounterId: req.CounterId, Subject: req.Subject, Role: req.Role}
+	if err := s.store.SetMember(ctx, m); err != nil {
+		return nil, memberError(ctx, "Failed to set member in database", err)
+	}
+	return &pbmember.MemberServiceSetResponse{Member: m}, nil
+}
+
+func (s *memberServer) Remove(ctx context.Context, req *pbmember.MemberServiceRemoveRequest) (*pbmember.MemberServiceRemoveResponse, error) {
+	// anyone can leave a counter, but only owners can remove someone else
+	role := pbmember.Role_ROLE_OWNER
+	if req.Subject == subjectFromContext(ctx) {
+		role = pbmember.Role_ROLE_VIEWER
+	}
+	if _, err := authorize(ctx, s.store, req.CounterId, role); err != nil {
+		return nil, err
+	}
+
+	if err := s.store.RemoveMember(ctx, req.CounterId, req.Subject); err != nil {
+		return nil, memberError(ctx, "Failed to remove member from database", err)
+	}
+	return &pbmember.MemberServiceRemoveResponse{}, nil
+}
+
+func (s *memberServer) CreateInvite(ctx context.Context, req *pbmember.MemberServiceCreateInviteRequest) (*pbmember.MemberServiceCreateInviteResponse, error) {
+	if _, err := authorize(ctx, s.store, req.CounterId, pbmember.Role_ROLE_OWNER); err != nil {
+		return nil, err
+	}
+
+	ttl := defaultInviteTTL
+	if req.Ttl != nil {
+		ttl = req.Ttl.AsDuration()
+	}
+
+	code, err := newInviteCode()
+	if err != nil {
+		return nil, internalError(ctx, "Failed to generate invite code", err)
+	}
+
+	invite := &store.Invite{
+		CounterID: req.CounterId,
+		Role:      req.Role,
+		CreatedBy: subjectFromContext(ctx),
+		ExpiresAt: s.now().Add(ttl),
+	}
+	if err := s.store.CreateInvite(ctx, hashSecret(code), invite); err != nil {
+		return nil, storageError(ctx, "counter", "Failed to insert invite into database", err)
+	}
+
+	return &pbmember.MemberServiceCreateInviteResponse{
+		Code:      code,
+		ExpiresAt: timestamppb.New(invite.ExpiresAt),
+	}, nil
+}
+
+func (s *memberServer) AcceptInvite(ctx context.Context, req *pbmember.MemberServiceAcceptInviteRequest) (*pbmember.MemberServiceAcceptInviteResponse, error) {
+	m, err := s.store.AcceptInvite(ctx, hashSecret(req.Code), subjectFromContext(ctx))
+	if err != nil {
+		// used, expired and made up codes all look the same
+		return nil, storageError(ctx, "invite", "Failed to accept invite", err)
+	}
+	return &pbmember.MemberServiceAcceptInviteResponse{Member: m}, nil
+}
+
+// Checks the caller has at least role on a counter, returning what they can
+// do with it. Counters they aren't a member of are NotFound, exactly like ones
+// which don't exist, so nobody can find out which IDs are in use.
+//
+// Roles aren't cached, so taking someone's access away works straight away.
+func authorize(ctx context.Context, members store.MemberStore, counterID string, role pbmember.Role) (*store.Access, error) {
+	if !keyAllowsCounter(ctx, counterID) {
+		return nil, status.Error(codes.NotFound, "counter not found")
+	}
+	access, err := members.GetAccess(ctx, counterID, subjectFromContext(ctx))
+	if err != nil {
+		return nil, storageError(ctx, "counter", "Failed to get role from database", err)
+	}
+	if access.Role < role {
+		return nil, status.Errorf(codes.PermissionDenied, "%s role required", roleName(role))
+	}
+	return access, nil
+}
+
+// "owner" for ROLE_OWNER.
+func roleName(role pbmember.Role) string {
+	name, _ := strings.CutPrefix(role.String(), "ROLE_")
+	return strings.ToLower(name)
+}
+
+// Like storageError, except that leaving a counter without an owner is
+// something the caller has to fix first.
+func memberError(ctx context.Context, msg string, err error) error {
+	if errors.Is(err, store.ErrLastOwner) {
+		return status.Error(codes.FailedPrecondition, "counter must keep at least one owner")
+	}
+	return storageError(ctx, "member", msg, err)
+}
+
+// A random invite code with 128 bits of entropy, which is plenty to make
+// guessing one hopeless.
+func newInviteCode() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Invite codes and API keys are random enough that a plain hash, rather than a
+// slow password hash, keeps them safe in the database.
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
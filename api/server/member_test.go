@@ -0,0 +1,262 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alextebbs/counters/auth"
+	pbcounter "github.com/alextebbs/counters/pb/counter/v1"
+	pbevent "github.com/alextebbs/counters/pb/event/v1"
+	pbmember "github.com/alextebbs/counters/pb/member/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+func as(subject string) context.Context {
+	return auth.NewContext(context.Background(), &auth.Principal{Subject: subject})
+}
+
+// Creates a counter owned by alice, shared with bob as role unless it's
+// ROLE_UNSPECIFIED.
+func (env *testEnv) shareCounter(t *testing.T, role pbmember.Role) *pbcounter.Counter {
+	t.Helper()
+
+	resp, err := env.counters.Create(as("alice"), &pbcounter.CounterServiceCreateRequest{Title: "days since last incident", EventTitle: "incident"})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if role != pbmember.Role_ROLE_UNSPECIFIED {
+		_, err := env.members.Set(as("alice"), &pbmember.MemberServiceSetRequest{CounterId: resp.Counter.Id, Subject: "bob", Role: role})
+		if err != nil {
+			t.Fatalf("Set: %v", err)
+		}
+	}
+	return resp.Counter
+}
+
+// What each role lets bob do with alice's counter.
+func TestMemberRoles(t *testing.T) {
+	calls := []struct {
+		name string
+		call func(env *testEnv, id string) error
+		// the lowest role which can make the call
+		role pbmember.Role
+	}{
+		{name: "Get", role: pbmember.Role_ROLE_VIEWER, call: func(env *testEnv, id string) error {
+			_, err := env.counters.Get(as("bob"), &pbcounter.CounterServiceGetRequest{Id: id})
+			return err
+		}},
+		{name: "events List", role: pbmember.Role_ROLE_VIEWER, call: func(env *testEnv, id string) error {
+			_, err := env.events.List(as("bob"), &pbevent.EventServiceListRequest{Id: id})
+			return err
+		}},
+		{name: "members List", role: pbmember.Role_ROLE_VIEWER, call: func(env *testEnv, id string) error {
+			_, err := env.members.List(as("bob"), &pbmember.MemberServiceListRequest{CounterId: id})
+			return err
+		}},
+		{name: "Increment", role: pbmember.Role_ROLE_EDITOR, call: func(env *testEnv, id string) error {
+			_, err := env.counters.Increment(as("bob"), &pbcounter.CounterServiceIncrementRequest{Id: id, Title: "incident"})
+			return err
+		}},
+		{name: "Set", role: pbmember.Role_ROLE_OWNER, call: func(env *testEnv, id string) error {
+			_, err := env.members.Set(as("bob"), &pbmember.MemberServiceSetRequest{CounterId: id, Subject: "carol", Role: pbmember.Role_ROLE_VIEWER})
+			return err
+		}},
+		{name: "CreateInvite", role: pbmember.Role_ROLE_OWNER, call: func(env *testEnv, id string) error {
+			_, err := env.members.CreateInvite(as("bob"), &pbmember.MemberServiceCreateInviteRequest{CounterId: id, Role: pbmember.Role_ROLE_VIEWER})
+			return err
+		}},
+		{name: "Delete", role: pbmember.Role_ROLE_OWNER, call: func(env *testEnv, id string) error {
+			_, err := env.counters.Delete(as("bob"), &pbcounter.CounterServiceDeleteRequest{Id: id})
+			return err
+		}},
+	}
+
+	roles := []pbmember.Role{pbmember.Role_ROLE_UNSPECIFIED, pbmember.Role_ROLE_VIEWER, pbmember.Role_ROLE_EDITOR, pbmember.Role_ROLE_OWNER}
+
+	for _, backend := range testStores {
+		for _, role := range roles {
+			for _, c := range calls {
+				t.Run(backend.name+"/"+role.String()+"/"+c.name, func(t *testing.T) {
+					env := newTestEnv(t, backend.new)
+					counter := env.shareCounter(t, role)
+
+					wantCode := codes.OK
+					switch {
+					case role == pbmember.Role_ROLE_UNSPECIFIED:
+						// not a member at all
+						wantCode = codes.NotFound
+					case role < c.role:
+						wantCode = codes.PermissionDenied
+					}
+
+					if err := c.call(env, counter.Id); status.Code(err) != wantCode {
+						t.Errorf("%s returned %v, want code %v", c.name, err, wantCode)
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestMemberIncrementCreatedBy(t *testing.T) {
+	for _, backend := range testStores {
+		t.Run(backend.name, func(t *testing.T) {
+			env := newTestEnv(t, backend.new)
+			counter := env.shareCounter(t, pbmember.Role_ROLE_EDITOR)
+
+			if _, err := env.counters.Increment(as("bob"), &pbcounter.CounterServiceIncrementRequest{Id: counter.Id, Title: "incident"}); err != nil {
+				t.Fatalf("Increment: %v", err)
+			}
+
+			// alice sees bob's increment, from the same cache entry
+			resp, err := env.events.List(as("alice"), &pbevent.EventServiceListRequest{Id: counter.Id})
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			var createdBy []string
+			for _, e := range resp.Events {
+				createdBy = append(createdBy, e.CreatedBy)
+			}
+			if len(createdBy) != 2 || createdBy[0] != "alice" || createdBy[1] != "bob" {
+				t.Errorf("events created by %v, want [alice bob]", createdBy)
+			}
+
+			got, err := env.counters.Get(as("alice"), &pbcounter.CounterServiceGetRequest{Id: counter.Id})
+			if err != nil {
+				t.Fatalf("Get: %v", err)
+			}
+			if got.Counter.Count != 1 {
+				t.Errorf("count = %d, want 1", got.Counter.Count)
+			}
+
+			list, err := env.counters.List(as("bob"), &pbcounter.CounterServiceListRequest{})
+			if err != nil {
+				t.Fatalf("List: %v", err)
+			}
+			if len(list.Counters) != 1 || list.Counters[0].Id != counter.Id {
+				t.Errorf("bob's List returned %v, want the shared counter", list.Counters)
+			}
+		})
+	}
+}
+
+func TestMemberInvite(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing pbmember.Role // bob's role before accepting
+		ttl      time.Duration // 0 for the default
+		wait     time.Duration // before accepting
+		wantCode codes.Code
+		wantRole pbmember.Role
+	}{
+		{name: "accepted", wantRole: pbmember.Role_ROLE_EDITOR},
+		{name: "upgrades", existing: pbmember.Role_ROLE_VIEWER, wantRole: pbmember.Role_ROLE_EDITOR},
+		{name: "doesn't downgrade", existing: pbmember.Role_ROLE_OWNER, wantRole: pbmember.Role_ROLE_OWNER},
+		{name: "default ttl", wait: 6 * 24 * time.Hour, wantRole: pbmember.Role_ROLE_EDITOR},
+		{name: "expired", ttl: time.Hour, wait: 2 * time.Hour, wantCode: codes.NotFound},
+	}
+
+	for _, backend := range testStores {
+		for _, tt := range tests {
+			t.Run(backend.name+"/"+tt.name, func(t *testing.T) {
+				env := newTestEnv(t, backend.new)
+				counter := env.shareCounter(t, tt.existing)
+
+				req := &pbmember.MemberServiceCreateInviteRequest{CounterId: counter.Id, Role: pbmember.Role_ROLE_EDITOR}
+				if tt.ttl != 0 {
+					req.Ttl = durationpb.New(tt.ttl)
+				}
+				invite, err := env.members.CreateInvite(as("alice"), req)
+				if err != nil {
+					t.Fatalf("CreateInvite: %v", err)
+				}
+				env.clock.now = env.clock.now.Add(tt.wait)
+
+				resp, err := env.members.AcceptInvite(as("bob"), &pbmember.MemberServiceAcceptInviteRequest{Code: invite.Code})
+				if code := status.Code(err); code != tt.wantCode {
+					t.Fatalf("AcceptInvite returned %v, want code %v", err, tt.wantCode)
+				}
+				if err != nil {
+					return
+				}
+				if resp.Member.Role != tt.wantRole {
+					t.Errorf("role = %v, want %v", resp.Member.Role, tt.wantRole)
+				}
+
+				// invites can only be used once
+				_, err = env.members.AcceptInvite(as("carol"), &pbmember.MemberServiceAcceptInviteRequest{Code: invite.Code})
+				if status.Code(err) != codes.NotFound {
+					t.Errorf("second AcceptInvite returned %v, want NotFound", err)
+				}
+			})
+		}
+	}
+}
+
+func TestMemberLastOwner(t *testing.T) {
+	tests := []struct {
+		name     string
+		bob      pbmember.Role // bob's role, unless bob isn't a member
+		change   func(env *testEnv, id string) error
+		wantCode codes.Code
+	}{
+		{name: "leave", change: func(env *testEnv, id string) error {
+			_, err := env.members.Remove(as("alice"), &pbmember.MemberServiceRemoveRequest{CounterId: id, Subject: "alice"})
+			return err
+		}, wantCode: codes.FailedPrecondition},
+		{name: "demote", change: func(env *testEnv, id string) error {
+			_, err := env.members.Set(as("alice"), &pbmember.MemberServiceSetRequest{CounterId: id, Subject: "alice", Role: pbmember.Role_ROLE_EDITOR})
+			return err
+		}, wantCode: codes.FailedPrecondition},
+		{name: "leave with another owner", bob: pbmember.Role_ROLE_OWNER, change: func(env *testEnv, id string) error {
+			_, err := env.members.Remove(as("alice"), &pbmember.MemberServiceRemoveRequest{CounterId: id, Subject: "alice"})
+			return err
+		}},
+		{name: "viewer leaves", bob: pbmember.Role_ROLE_VIEWER, change: func(env *testEnv, id string) error {
+			_, err := env.members.Remove(as("bob"), &pbmember.MemberServiceRemoveRequest{CounterId: id, Subject: "bob"})
+			return err
+		}},
+		{name: "viewer removes someone else", bob: pbmember.Role_ROLE_VIEWER, change: func(env *testEnv, id string) error {
+			_, err := env.members.Remove(as("bob"), &pbmember.MemberServiceRemoveRequest{CounterId: id, Subject: "alice"})
+			return err
+		}, wantCode: codes.PermissionDenied},
+		{name: "remove a stranger", change: func(env *testEnv, id string) error {
+			_, err := env.members.Remove(as("alice"), &pbmember.MemberServiceRemoveRequest{CounterId: id, Subject: "carol"})
+			return err
+		}, wantCode: codes.NotFound},
+	}
+
+	for _, backend := range testStores {
+		for _, tt := range tests {
+			t.Run(backend.name+"/"+tt.name, func(t *testing.T) {
+				env := newTestEnv(t, backend.new)
+				counter := env.shareCounter(t, tt.bob)
+
+				if err := tt.change(env, counter.Id); status.Code(err) != tt.wantCode {
+					t.Fatalf("got %v, want code %v", err, tt.wantCode)
+				}
+
+				// whatever happened, someone still owns the counter
+				var owners int
+				for _, subject := range []string{"alice", "bob"} {
+					resp, err := env.members.List(as(subject), &pbmember.MemberServiceListRequest{CounterId: counter.Id})
+					if err != nil {
+						continue
+					}
+					for _, m := range resp.Members {
+						if m.Role == pbmember.Role_ROLE_OWNER {
+							owners++
+						}
+					}
+					break
+				}
+				if owners == 0 {
+					t.Error("counter has no owner left")
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// Everything here is registered with the default prometheus registry, which
+// also collects go runtime and process metrics, and is served on /metrics.
+var (
+	rpcStarted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_server_started_total",
+		Help: "Total number of RPCs started on the server.",
+	}, []string{"grpc_service", "grpc_method"})
+
+	rpcHandled = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "grpc_server_handled_total",
+		Help: "Total number of RPCs completed on the server, regardless of success or failure.",
+	}, []string{"grpc_service", "grpc_method", "grpc_code"})
+
+	rpcDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "grpc_server_handling_seconds",
+		Help:    "Latency of RPCs handled by the server.",
+		Buckets: []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10},
+	}, []string{"grpc_service", "grpc_method"})
+
+	countersCreated = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "counters_created_total",
+		Help: "Total number of counters created.",
+	})
+
+	// rate(counters_increments_total[1m]) * 60 gives increments per minute
+	countersIncremented = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "counters_increments_total",
+		Help: "Total number of counter increments.",
+	})
+
+	countersDeleted = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "counters_deleted_total",
+		Help: "Total number of counters deleted.",
+	})
+)
+
+// Splits "/counter.v1.CounterService/Increment" into its service and method.
+func splitMethodName(fullMethod string) (string, string) {
+	fullMethod = strings.TrimPrefix(fullMethod, "/")
+	if i := strings.LastIndex(fullMethod, "/"); i >= 0 {
+		return fullMethod[:i], fullMethod[i+1:]
+	}
+	return "unknown", fullMethod
+}
+
+func observeRPC(fullMethod string, start time.Time, err error) {
+	service, method := splitMethodName(fullMethod)
+	rpcHandled.WithLabelValues(service, method, status.Code(err).String()).Inc()
+	rpcDuration.WithLabelValues(service, method).Observe(time.Since(start).Seconds())
+}
+
+func metricsUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	rpcStarted.WithLabelValues(splitMethodName(info.FullMethod)).Inc()
+	start := time.Now()
+
+	resp, err := handler(ctx, req)
+	observeRPC(info.FullMethod, start, err)
+
+	return resp, err
+}
+
+func metricsStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	rpcStarted.WithLabelValues(splitMethodName(info.FullMethod)).Inc()
+	start := time.Now()
+
+	err := handler(srv, ss)
+	observeRPC(info.FullMethod, start, err)
+
+	return err
+}
@@ -0,0 +1,71 @@
+package server
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+)
+
+// Picks the page of ids asked for by a List request. The stores list every ID
+// in a stable order, so a page is a slice of them, and its token records where
+// the next one starts along with the last ID returned. If things before that
+// ID were deleted in between pages, the ID is found again rather than skipping
+// ahead by the offset alone. A pageSize of 0 returns everything after the
+// token.
+func paginate(ids []string, pageSize int32, pageToken string) (page []string, nextPageToken string, err error) {
+	start := 0
+	if pageToken != "" {
+		start, err = decodePageToken(ids, pageToken)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	end := len(ids)
+	if pageSize > 0 && start+int(pageSize) < end {
+		end = start + int(pageSize)
+	}
+
+	page = ids[start:end]
+	if end < len(ids) {
+		nextPageToken = encodePageToken(end, ids[end-1])
+	}
+	return page, nextPageToken, nil
+}
+
+func encodePageToken(offset int, lastID string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset) + ":" + lastID))
+}
+
+// Where the page after the token starts in ids.
+func decodePageToken(ids []string, token string) (int, error) {
+	invalid := invalidArgument(fieldViolation("page_token", "invalid page token"))
+
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return 0, invalid
+	}
+	offsetText, lastID, ok := strings.Cut(string(b), ":")
+	if !ok {
+		return 0, invalid
+	}
+	offset, err := strconv.Atoi(offsetText)
+	if err != nil || offset < 1 {
+		return 0, invalid
+	}
+
+	if offset <= len(ids) && ids[offset-1] == lastID {
+		return offset, nil
+	}
+	for i, id := range ids {
+		if id == lastID {
+			return i + 1, nil
+		}
+	}
+
+	// the last ID was deleted as well, so the offset is the best guess left
+	if offset > len(ids) {
+		return len(ids), nil
+	}
+	return offset, nil
+}
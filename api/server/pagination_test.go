@@ -0,0 +1,74 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestPaginate(t *testing.T) {
+	ids := []string{"a", "b", "c", "d", "e"}
+
+	tests := []struct {
+		name     string
+		ids      []string // what's listed when the token is used, if not ids
+		pageSize int32
+		token    string
+		wantPage []string
+		wantNext bool
+		wantCode codes.Code
+	}{
+		{name: "everything", wantPage: ids},
+		{name: "first page", pageSize: 2, wantPage: []string{"a", "b"}, wantNext: true},
+		{name: "page size larger than list", pageSize: 10, wantPage: ids},
+		{name: "exactly one page", pageSize: 5, wantPage: ids},
+		{name: "middle page", pageSize: 2, token: encodePageToken(2, "b"), wantPage: []string{"c", "d"}, wantNext: true},
+		{name: "last page", pageSize: 2, token: encodePageToken(4, "d"), wantPage: []string{"e"}},
+		{name: "rest after token", token: encodePageToken(2, "b"), wantPage: []string{"c", "d", "e"}},
+		{
+			name:     "earlier id deleted",
+			ids:      []string{"b", "c", "d", "e"},
+			pageSize: 2,
+			token:    encodePageToken(2, "b"),
+			wantPage: []string{"c", "d"},
+			wantNext: true,
+		},
+		{
+			name:     "last id deleted",
+			ids:      []string{"a", "c", "d", "e"},
+			pageSize: 2,
+			token:    encodePageToken(2, "b"),
+			wantPage: []string{"d", "e"},
+		},
+		{name: "everything deleted", ids: []string{}, token: encodePageToken(2, "b"), wantPage: []string{}},
+		{name: "garbage token", token: "not a token!", wantCode: codes.InvalidArgument},
+		{name: "token without id", token: "Mg", wantCode: codes.InvalidArgument},
+		{name: "token with bad offset", token: encodePageToken(0, "a"), wantCode: codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list := ids
+			if tt.ids != nil {
+				list = tt.ids
+			}
+
+			page, next, err := paginate(list, tt.pageSize, tt.token)
+			if code := status.Code(err); code != tt.wantCode {
+				t.Fatalf("paginate returned %v, want code %v", err, tt.wantCode)
+			}
+			if err != nil {
+				return
+			}
+
+			if fmt.Sprint(page) != fmt.Sprint(tt.wantPage) {
+				t.Errorf("page = %v, want %v", page, tt.wantPage)
+			}
+			if (next != "") != tt.wantNext {
+				t.Errorf("next page token = %q, want one: %v", next, tt.wantNext)
+			}
+		})
+	}
+}
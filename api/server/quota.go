@@ -0,0 +1,60 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/alextebbs/counters/store"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+)
+
+// Limits on how much can be stored, 0 for no limit. They're checked before
+// writing rather than in the same transaction, so calls racing each other can
+// go a little over, which the rate limit keeps small.
+type Quotas struct {
+	// Counters each user can create, whoever they've been shared with since.
+	MaxCountersPerUser int
+	// Events each counter can have per UTC day, including the one it's
+	// created with.
+	MaxEventsPerCounterPerDay int
+}
+
+func (q Quotas) checkCounters(ctx context.Context, counters store.CounterStore, owner string) error {
+	if q.MaxCountersPerUser <= 0 {
+		return nil
+	}
+
+	n, err := counters.CountCounters(ctx, owner)
+	if err != nil {
+		return storageError(ctx, "counter", "Failed to count counters in database", err)
+	}
+	if n < q.MaxCountersPerUser {
+		return nil
+	}
+	return quotaError(fmt.Sprintf("at most %d counters can be created", q.MaxCountersPerUser), "user:"+owner, 0)
+}
+
+func (q Quotas) checkEvents(ctx context.Context, events store.EventStore, counterID string, now time.Time) error {
+	if q.MaxEventsPerCounterPerDay <= 0 {
+		return nil
+	}
+
+	day := now.UTC().Truncate(24 * time.Hour)
+	n, err := events.CountEvents(ctx, counterID, day)
+	if err != nil {
+		return storageError(ctx, "counter", "Failed to count events in database", err)
+	}
+	if n < q.MaxEventsPerCounterPerDay {
+		return nil
+	}
+	// the quota comes back at midnight
+	retryAfter := day.Add(24 * time.Hour).Sub(now)
+	return quotaError(fmt.Sprintf("at most %d events can be added to a counter per day", q.MaxEventsPerCounterPerDay), "counter:"+counterID, retryAfter)
+}
+
+func quotaError(description, subject string, retryAfter time.Duration) error {
+	return resourceExhausted("quota exceeded: "+description, retryAfter, &errdetails.QuotaFailure{
+		Violations: []*errdetails.QuotaFailure_Violation{{Subject: subject, Description: description}},
+	})
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	pbcounter "github.com/alextebbs/counters/pb/counter/v1"
+	pbmember "github.com/alextebbs/counters/pb/member/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestQuotaCounters(t *testing.T) {
+	for _, backend := range testStores {
+		t.Run(backend.name, func(t *testing.T) {
+			env := newTestEnv(t, backend.new)
+			env.counters.quotas = Quotas{MaxCountersPerUser: 2}
+			create := func(subject string) error {
+				_, err := env.counters.Create(as(subject), &pbcounter.CounterServiceCreateRequest{Title: "coffee", EventTitle: "first cup"})
+				return err
+			}
+
+			for i := 0; i < 2; i++ {
+				if err := create("alice"); err != nil {
+					t.Fatalf("Create %d: %v", i, err)
+				}
+			}
+			err := create("alice")
+			if status.Code(err) != codes.ResourceExhausted {
+				t.Fatalf("third Create returned %v, want ResourceExhausted", err)
+			}
+			if !hasDetail[*errdetails.QuotaFailure](err) {
+				t.Errorf("%v doesn't have QuotaFailure details", err)
+			}
+
+			// everyone has their own quota
+			if err := create("bob"); err != nil {
+				t.Errorf("bob's Create: %v", err)
+			}
+		})
+	}
+}
+
+func TestQuotaEvents(t *testing.T) {
+	for _, backend := range testStores {
+		t.Run(backend.name, func(t *testing.T) {
+			env := newTestEnv(t, backend.new)
+			env.clock.now = time.Date(2024, 1, 1, 22, 0, 0, 0, time.UTC)
+			env.counters.quotas = Quotas{MaxEventsPerCounterPerDay: 3}
+			// bob's increments count against alice's counter too
+			counter := env.shareCounter(t, pbmember.Role_ROLE_EDITOR)
+			increment := func(subject string) error {
+				env.clock.now = env.clock.now.Add(time.Minute)
+				_, err := env.counters.Increment(as(subject), &pbcounter.CounterServiceIncrementRequest{Id: counter.Id, Title: "incident"})
+				return err
+			}
+
+			// the event it was created with is one of the 3
+			for _, subject := range []string{"alice", "bob"} {
+				if err := increment(subject); err != nil {
+					t.Fatalf("%s's Increment: %v", subject, err)
+				}
+			}
+			err := increment("alice")
+			if status.Code(err) != codes.ResourceExhausted {
+				t.Fatalf("fourth event returned %v, want ResourceExhausted", err)
+			}
+			// it's 22:03, so the quota comes back at midnight
+			var retryDelay time.Duration
+			st, _ := status.FromError(err)
+			for _, d := range st.Details() {
+				if info, ok := d.(*errdetails.RetryInfo); ok {
+					retryDelay = info.RetryDelay.AsDuration()
+				}
+			}
+			if want := 117 * time.Minute; retryDelay != want {
+				t.Errorf("RetryInfo delay = %v, want %v", retryDelay, want)
+			}
+
+			env.clock.now = env.clock.now.Add(2 * time.Hour)
+			if err := increment("alice"); err != nil {
+				t.Errorf("Increment the next day: %v", err)
+			}
+		})
+	}
+}
+
+// Whether err is a status with a T in its details.
+func hasDetail[T any](err error) bool {
+	st, _ := status.FromError(err)
+	for _, d := range st.Details() {
+		if _, ok := d.(T); ok {
+			return true
+		}
+	}
+	return false
+}
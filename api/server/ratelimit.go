@@ -0,0 +1,75 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+
+	"github.com/alextebbs/counters/auth"
+	"github.com/alextebbs/counters/ratelimit"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/peer"
+)
+
+// Takes a token from the caller's bucket for the method, so a script stuck in
+// a loop only slows itself down, and only on the method it's looping on.
+// Health checks and reflection are never limited. If the limiter fails, calls
+// are let through rather than the api going down with Redis.
+func rateLimit(ctx context.Context, l ratelimit.Limiter, limit ratelimit.Limit, fullMethod string) error {
+	service, _ := splitMethodName(fullMethod)
+	if unauthenticatedServices[service] {
+		return nil
+	}
+
+	ok, retryAfter, err := l.Allow(ctx, rateLimitKey(ctx, fullMethod), limit)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to check rate limit", "method", fullMethod, "err", err)
+		return nil
+	}
+	if ok {
+		return nil
+	}
+
+	return resourceExhausted(fmt.Sprintf("rate limit exceeded, retry in %s", retryAfter), retryAfter)
+}
+
+// Each API key gets its own buckets, separate from its user's, so a runaway
+// cron job doesn't lock its owner out too. Without auth, callers are told apart
+// by address.
+func rateLimitKey(ctx context.Context, fullMethod string) string {
+	var caller string
+	if p, ok := auth.FromContext(ctx); ok {
+		caller = "user:" + url.QueryEscape(p.Subject)
+		if p.Key != nil {
+			caller = "key:" + p.Key.Id
+		}
+	} else if p, ok := peer.FromContext(ctx); ok {
+		// not the port, which is different for each connection
+		host, _, err := net.SplitHostPort(p.Addr.String())
+		if err != nil {
+			host = p.Addr.String()
+		}
+		caller = "addr:" + host
+	}
+	return "ratelimit:" + caller + ":" + fullMethod
+}
+
+func rateLimitUnaryInterceptor(l ratelimit.Limiter, limit ratelimit.Limit) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if err := rateLimit(ctx, l, limit, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func rateLimitStreamInterceptor(l ratelimit.Limiter, limit ratelimit.Limit) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if err := rateLimit(ss.Context(), l, limit, info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
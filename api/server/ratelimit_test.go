@@ -0,0 +1,75 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/alextebbs/counters/client"
+	"github.com/alextebbs/counters/ratelimit"
+	"github.com/alextebbs/counters/store"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// A Limiter whose Redis has gone away.
+type brokenLimiter struct{}
+
+func (brokenLimiter) Allow(ctx context.Context, key string, limit ratelimit.Limit) (bool, time.Duration, error) {
+	return false, 0, errors.New("connection refused")
+}
+
+func TestRateLimit(t *testing.T) {
+	conn := newTestServer(t, Options{
+		Store:       store.NewMemoryStore(),
+		RateLimiter: ratelimit.NewLocalLimiter(),
+		// one call, then one an hour
+		RateLimit: ratelimit.Limit{Rate: 1.0 / 3600, Burst: 1},
+	})
+	c := client.New(conn, client.Options{MaxRetries: -1})
+	ctx := context.Background()
+
+	counter, err := c.Create(ctx, "coffee", "first cup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := c.IncrementNow(ctx, counter.Id, "second cup"); err != nil {
+		t.Fatalf("first Increment: %v", err)
+	}
+
+	_, _, err = c.IncrementNow(ctx, counter.Id, "third cup")
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("second Increment returned %v, want ResourceExhausted", err)
+	}
+	if !hasDetail[*errdetails.RetryInfo](err) {
+		t.Errorf("%v doesn't have RetryInfo details", err)
+	}
+
+	// every method has its own bucket
+	if _, err := c.Get(ctx, counter.Id); err != nil {
+		t.Errorf("Get after Increment was limited: %v", err)
+	}
+
+	// and health checks have none
+	for i := 0; i < 3; i++ {
+		if _, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+			t.Errorf("health check %d: %v", i, err)
+		}
+	}
+}
+
+func TestRateLimitFailsOpen(t *testing.T) {
+	conn := newTestServer(t, Options{
+		Store:       store.NewMemoryStore(),
+		RateLimiter: brokenLimiter{},
+		RateLimit:   ratelimit.Limit{Rate: 1, Burst: 1},
+	})
+	c := client.New(conn, client.Options{MaxRetries: -1})
+
+	if _, err := c.Create(context.Background(), "coffee", "first cup"); err != nil {
+		t.Errorf("Create with the limiter down: %v", err)
+	}
+}
@@ -0,0 +1,217 @@
+// Package server implements CounterService, EventService, MemberService,
+// KeyService and AdminService on top of a store and a cache, along with the interceptors,
+// health checks and web handler the api binary serves them with. It can be
+// embedded in other binaries, or run in-process by tests:
+//
+//	s, err := server.New(server.Options{Store: store.NewMemoryStore()})
+//	if err != nil {
+//		return err
+//	}
+//	go s.Serve(lis)
+//	defer s.Stop()
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/alextebbs/counters/auth"
+	"github.com/alextebbs/counters/cache"
+	pbadmin "github.com/alextebbs/counters/pb/admin/v1"
+	pbcounter "github.com/alextebbs/counters/pb/counter/v1"
+	pbevent "github.com/alextebbs/counters/pb/event/v1"
+	pbkey "github.com/alextebbs/counters/pb/key/v1"
+	pbmember "github.com/alextebbs/counters/pb/member/v1"
+	"github.com/alextebbs/counters/ratelimit"
+	"github.com/alextebbs/counters/store"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+)
+
+// Options for New. Only Store is required.
+type Options struct {
+	// Where counters and events are kept.
+	Store store.Store
+	// Read-through cache in front of Store. Defaults to a LocalCache.
+	Cache cache.Cache
+
+	// AdminService warms and checks the Redis cache from the postgres rows
+	// behind it, so it's only registered when both are set.
+	DB              *sql.DB
+	Redis           *cache.RedisService
+	WarmBatchSize   int
+	WarmConcurrency int
+
+	// Deadline for unary RPCs which arrive without one, 0 for none.
+	RequestTimeout time.Duration
+	// Checks the bearer token on every call except health checks and
+	// reflection. Anyone can call anything when it's nil. API keys from
+	// KeyService, which is only registered when it's set, are checked before
+	// it.
+	Auth auth.Authenticator
+	// Subjects who can call AdminService and create keys with SCOPE_ADMIN when
+	// Auth is set. Nobody can when it's empty. Without Auth, everyone can.
+	Admins []string
+
+	// A token bucket of RateLimit for each caller and method, checked after
+	// auth. Use a RedisLimiter so replicas share them. No limit when it's nil.
+	RateLimiter ratelimit.Limiter
+	RateLimit   ratelimit.Limit
+	Quotas      Quotas
+
+	// A check for each dependency in use, keyed by DependencyDatabase or
+	// DependencyRedis, which Run probes every HealthInterval with
+	// HealthTimeout. Default to 5s and 2s.
+	HealthChecks   map[string]HealthCheck
+	HealthInterval time.Duration
+	HealthTimeout  time.Duration
+
+	// Origins browsers can call WebHandler from, none when it's only used from
+	// the same host, and how long they can cache preflight responses for.
+	AllowedOrigins []string
+	CORSMaxAge     time.Duration
+
+	// Serves gRPC over TLS when set.
+	TLS *tls.Config
+	// Any other options for the grpc.Server.
+	GRPCOptions []grpc.ServerOption
+}
+
+// The gRPC server with every service registered on it.
+type Server struct {
+	grpc   *grpc.Server
+	prober *HealthProber
+	warmer *cache.Warmer
+	opts   Options
+}
+
+func New(opts Options) (*Server, error) {
+	if opts.Store == nil {
+		return nil, errors.New("server: Options.Store is required")
+	}
+	if opts.RateLimiter != nil && (opts.RateLimit.Rate <= 0 || opts.RateLimit.Burst < 1) {
+		return nil, errors.New("server: Options.RateLimit needs a positive Rate and Burst")
+	}
+	if opts.Cache == nil {
+		opts.Cache = cache.NewLocalCache()
+	}
+	if opts.HealthInterval <= 0 {
+		opts.HealthInterval = 5 * time.Second
+	}
+	if opts.HealthTimeout <= 0 {
+		opts.HealthTimeout = 2 * time.Second
+	}
+
+	var grpcOpts []grpc.ServerOption
+	if opts.TLS != nil {
+		grpcOpts = append(grpcOpts, grpc.Creds(credentials.NewTLS(opts.TLS)))
+	}
+
+	// rejected calls are still logged and counted, but nothing past auth runs
+	// for them, so validation errors don't describe the API to strangers.
+	unary := []grpc.UnaryServerInterceptor{loggingUnaryInterceptor, metricsUnaryInterceptor, deadlineUnaryInterceptor(opts.RequestTimeout)}
+	stream := []grpc.StreamServerInterceptor{loggingStreamInterceptor, metricsStreamInterceptor}
+	admins := newAdmins(opts.Admins)
+	if opts.Auth != nil {
+		a := &keyAuthenticator{keys: opts.Store, next: opts.Auth, now: time.Now}
+		unary = append(unary, authUnaryInterceptor(a, admins))
+		stream = append(stream, authStreamInterceptor(a, admins))
+	}
+	if opts.RateLimiter != nil {
+		unary = append(unary, rateLimitUnaryInterceptor(opts.RateLimiter, opts.RateLimit))
+		stream = append(stream, rateLimitStreamInterceptor(opts.RateLimiter, opts.RateLimit))
+	}
+	unary = append(unary, errorsUnaryInterceptor, validationUnaryInterceptor)
+	stream = append(stream, errorsStreamInterceptor, validationStreamInterceptor)
+
+	grpcOpts = append(grpcOpts,
+		grpc.StatsHandler(otelgrpc.NewServerHandler()),
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.ChainStreamInterceptor(stream...),
+	)
+	grpcOpts = append(grpcOpts, opts.GRPCOptions...)
+
+	s := &Server{grpc: grpc.NewServer(grpcOpts...), opts: opts}
+
+	pbcounter.RegisterCounterServiceServer(s.grpc, &counterServer{
+		store:   opts.Store,
+		members: opts.Store,
+		cache:   opts.Cache,
+		events:  opts.Store,
+		quotas:  opts.Quotas,
+		now:     time.Now,
+	})
+	pbevent.RegisterEventServiceServer(s.grpc, &eventServer{store: opts.Store, members: opts.Store, cache: opts.Cache})
+	pbmember.RegisterMemberServiceServer(s.grpc, &memberServer{store: opts.Store, now: time.Now})
+	// keys belong to a user, so there's nobody to give them to without auth
+	if opts.Auth != nil {
+		pbkey.RegisterKeyServiceServer(s.grpc, &keyServer{store: opts.Store, admins: admins, now: time.Now})
+	}
+
+	if opts.DB != nil && opts.Redis != nil {
+		s.warmer = cache.NewWarmer(opts.DB, opts.Redis, opts.WarmBatchSize, opts.WarmConcurrency)
+		pbadmin.RegisterAdminServiceServer(s.grpc, &adminServer{
+			warmer:  s.warmer,
+			checker: cache.NewChecker(opts.DB, opts.Redis),
+		})
+	}
+
+	// every service flips to NOT_SERVING when its dependencies are unhealthy,
+	// and for good once we start draining, so nothing new gets routed here.
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(s.grpc, healthServer)
+	s.prober = NewHealthProber(healthServer, opts.HealthChecks, opts.HealthInterval, opts.HealthTimeout)
+
+	reflection.Register(s.grpc)
+
+	return s, nil
+}
+
+// GRPCServer is the underlying server, for registering more services before
+// Serve is called.
+func (s *Server) GRPCServer() *grpc.Server {
+	return s.grpc
+}
+
+// Serve accepts gRPC connections on lis until GracefulStop or Stop.
+func (s *Server) Serve(lis net.Listener) error {
+	return s.grpc.Serve(lis)
+}
+
+// Run keeps the health statuses up to date until ctx is done.
+func (s *Server) Run(ctx context.Context) {
+	s.prober.Run(ctx)
+}
+
+// Health serves the same statuses over HTTP, for k8s probes.
+func (s *Server) Health() *HealthProber {
+	return s.prober
+}
+
+// Warmer rebuilds the Redis cache, nil unless Options.DB and Redis were set.
+func (s *Server) Warmer() *cache.Warmer {
+	return s.warmer
+}
+
+// Drain reports every service as NOT_SERVING from now on, so load balancers
+// stop sending us new requests before we stop.
+func (s *Server) Drain() {
+	s.prober.Drain()
+}
+
+// GracefulStop waits for in-flight RPCs to finish, Stop cancels them.
+func (s *Server) GracefulStop() {
+	s.grpc.GracefulStop()
+}
+
+func (s *Server) Stop() {
+	s.grpc.Stop()
+}
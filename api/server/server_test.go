@@ -0,0 +1,81 @@
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/alextebbs/counters/client"
+	"github.com/alextebbs/counters/store"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// Serves New(opts) over an in-memory listener, returning a connection to it.
+func newTestServer(t *testing.T, opts Options) *grpc.ClientConn {
+	t.Helper()
+
+	s, err := New(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lis := bufconn.Listen(1 << 20)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// The whole server in-process, through the interceptors, as another binary
+// embedding it would use it.
+func TestServer(t *testing.T) {
+	c := client.New(newTestServer(t, Options{Store: store.NewMemoryStore()}), client.Options{})
+
+	ctx := context.Background()
+	counter, err := c.Create(ctx, "coffee", "first cup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := c.IncrementNow(ctx, counter.Id, "second cup"); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := c.Events(ctx, counter.Id).All()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[1].Title != "second cup" {
+		t.Errorf("got events %v, want first and second cup", events)
+	}
+
+	// validation runs before the handlers
+	if _, err := c.Get(ctx, "nope"); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Get with an invalid id returned %v, want InvalidArgument", err)
+	}
+
+	if err := c.Delete(ctx, counter.Id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get(ctx, counter.Id); status.Code(err) != codes.NotFound {
+		t.Errorf("Get after Delete returned %v, want NotFound", err)
+	}
+}
+
+func TestNewRequiresStore(t *testing.T) {
+	if _, err := New(Options{}); err == nil {
+		t.Error("New without a Store succeeded")
+	}
+}
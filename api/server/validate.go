@@ -0,0 +1,60 @@
+package server
+
+import (
+	"context"
+	"errors"
+
+	"github.com/bufbuild/protovalidate-go"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// Checks a request against the buf.validate constraints declared in its
+// proto, so handlers can assume ids are uuids, titles aren't empty and so on.
+func validateRequest(ctx context.Context, req any) error {
+	msg, ok := req.(proto.Message)
+	if !ok {
+		return nil
+	}
+
+	err := protovalidate.Validate(msg)
+	if err == nil {
+		return nil
+	}
+
+	var validationErr *protovalidate.ValidationError
+	if !errors.As(err, &validationErr) {
+		// the constraints themselves are broken, which isn't the client's fault
+		return internalError(ctx, "Failed to validate request", err)
+	}
+
+	violations := make([]*errdetails.BadRequest_FieldViolation, 0, len(validationErr.Violations))
+	for _, v := range validationErr.Violations {
+		violations = append(violations, fieldViolation(protovalidate.FieldPathString(v.Proto.GetField()), v.Proto.GetMessage()))
+	}
+	return invalidArgument(violations...)
+}
+
+func validationUnaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if err := validateRequest(ctx, req); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func validationStreamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	return handler(srv, &validatingServerStream{ss})
+}
+
+// A grpc.ServerStream which validates each message it receives.
+type validatingServerStream struct {
+	grpc.ServerStream
+}
+
+func (s *validatingServerStream) RecvMsg(m any) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return validateRequest(s.Context(), m)
+}
@@ -0,0 +1,83 @@
+package server
+
+import (
+	"crypto/tls"
+	_ "embed"
+	"net/http"
+	"time"
+
+	"connectrpc.com/cors"
+	"connectrpc.com/vanguard"
+	"connectrpc.com/vanguard/vanguardgrpc"
+	rscors "github.com/rs/cors"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// Lets the gRPC server take JSON as well as binary protobuf, so Connect and
+// gRPC-Web requests using JSON are passed straight through rather than being
+// converted first.
+func init() {
+	encoding.RegisterCodec(vanguardgrpc.NewCodec(&vanguard.JSONCodec{
+		MarshalOptions:   protojson.MarshalOptions{EmitUnpopulated: true},
+		UnmarshalOptions: protojson.UnmarshalOptions{DiscardUnknown: true},
+	}))
+}
+
+// Generated from the google.api.http annotations in protos/ by buf generate,
+// for anyone using the REST routes.
+//
+//go:embed openapi/openapi.yaml
+var openAPIDocument []byte
+
+// Methods and headers the REST routes and our interceptors use, on top of the
+// ones the RPC protocols need themselves.
+var (
+	webAllowedMethods = []string{http.MethodPut, http.MethodDelete}
+	webAllowedHeaders = []string{"Authorization", "X-Request-Id", "Traceparent", "Tracestate"}
+	webExposedHeaders = []string{"X-Request-Id"}
+)
+
+// WebHandler serves every service over gRPC, gRPC-Web and the Connect
+// protocol, so browsers can call the API without a proxy in front, and as JSON
+// over the REST routes in the protos' google.api.http annotations, which are
+// described by /openapi.yaml. Requests in the other protocols are translated
+// to gRPC and go through the same interceptors as any other.
+func (s *Server) WebHandler() (http.Handler, error) {
+	transcoder, err := vanguardgrpc.NewTranscoder(s.grpc)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/", transcoder)
+	mux.HandleFunc("/openapi.yaml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/yaml")
+		w.Write(openAPIDocument)
+	})
+
+	// without any allowed origins browsers can't call us cross-origin, which
+	// is fine when the frontend is served from the same host.
+	if len(s.opts.AllowedOrigins) == 0 {
+		return mux, nil
+	}
+
+	return rscors.New(rscors.Options{
+		AllowedOrigins: s.opts.AllowedOrigins,
+		AllowedMethods: append(cors.AllowedMethods(), webAllowedMethods...),
+		AllowedHeaders: append(cors.AllowedHeaders(), webAllowedHeaders...),
+		ExposedHeaders: append(cors.ExposedHeaders(), webExposedHeaders...),
+		MaxAge:         int(s.opts.CORSMaxAge / time.Second),
+	}).Handler(mux), nil
+}
+
+// NewWebServer makes an http.Server for WebHandler. gRPC needs HTTP/2, which Go
+// only speaks over TLS unless it's told to accept it in cleartext as well.
+func NewWebServer(addr string, handler http.Handler, tlsConfig *tls.Config) *http.Server {
+	if tlsConfig != nil {
+		return &http.Server{Addr: addr, Handler: handler, TLSConfig: tlsConfig.Clone()}
+	}
+	return &http.Server{Addr: addr, Handler: h2c.NewHandler(handler, &http2.Server{})}
+}
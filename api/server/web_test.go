@@ -0,0 +1,95 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWebHandler(t *testing.T) {
+	env := newTestEnv(t, testStores[0].new)
+	c := env.createCounter(t, "coffee", time.Minute)
+
+	s, err := New(Options{Store: env.store, Cache: env.cache, AllowedOrigins: []string{"http://localhost:3000"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler, err := s.WebHandler()
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		header   http.Header
+		body     string
+		wantCode int
+		wantBody string // a substring of the response body
+	}{
+		{name: "rest get", method: "GET", path: "/v1/counters/" + c.Id, wantCode: 200, wantBody: `"count":1`},
+		{name: "rest list events", method: "GET", path: "/v1/counters/" + c.Id + "/events", wantCode: 200, wantBody: `"title":"increment 1"`},
+		{name: "rest increment", method: "POST", path: "/v1/counters/" + c.Id + ":increment", body: `{"title":"again"}`, wantCode: 200, wantBody: `"count":2`},
+		{name: "rest invalid", method: "GET", path: "/v1/counters/nope", wantCode: 400, wantBody: `"field":"id"`},
+		{name: "rest missing", method: "DELETE", path: "/v1/counters/" + missingID, wantCode: 404},
+		{
+			name:     "connect",
+			method:   "POST",
+			path:     "/counter.v1.CounterService/Get",
+			header:   http.Header{"Connect-Protocol-Version": {"1"}},
+			body:     `{"id":"` + c.Id + `"}`,
+			wantCode: 200,
+			wantBody: `"title":"coffee"`,
+		},
+		{
+			name:     "cors preflight",
+			method:   "OPTIONS",
+			path:     "/v1/counters/" + c.Id,
+			header:   http.Header{"Origin": {"http://localhost:3000"}, "Access-Control-Request-Method": {"DELETE"}},
+			wantCode: 204,
+		},
+		{name: "openapi", method: "GET", path: "/openapi.yaml", wantCode: 200, wantBody: "/v1/counters/{id}:increment"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, server.URL+tt.path, strings.NewReader(tt.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for k, v := range tt.header {
+				req.Header[k] = v
+			}
+			if tt.body != "" {
+				req.Header.Set("Content-Type", "application/json")
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, _ := io.ReadAll(resp.Body)
+
+			if resp.StatusCode != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", resp.StatusCode, tt.wantCode, body)
+			}
+			if !strings.Contains(string(body), tt.wantBody) {
+				t.Errorf("body = %s, want it to contain %s", body, tt.wantBody)
+			}
+			if tt.method != "OPTIONS" && strings.HasPrefix(tt.path, "/v1/") && !json.Valid(body) {
+				t.Errorf("body isn't JSON: %s", body)
+			}
+			if tt.header.Get("Origin") != "" && resp.Header.Get("Access-Control-Allow-Origin") != tt.header.Get("Origin") {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", resp.Header.Get("Access-Control-Allow-Origin"), tt.header.Get("Origin"))
+			}
+		})
+	}
+}
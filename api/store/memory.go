@@ -0,0 +1,401 @@
+package store
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	pbcounter "github.com/alextebbs/counters/pb/counter/v1"
+	pbevent "github.com/alextebbs/counters/pb/event/v1"
+	pbkey "github.com/alextebbs/counters/pb/key/v1"
+	pbmember "github.com/alextebbs/counters/pb/member/v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// A Store which keeps everything in maps, for tests.
+// Messages are cloned on the way in and out so callers can't modify what's
+// stored.
+type MemoryStore struct {
+	mu       sync.Mutex
+	now      func() time.Time
+	counters map[string]*pbcounter.Counter
+	events   map[string]*pbevent.Event
+	// IDs in the order they were created, which is the order they're listed in
+	counterIDs []string
+	eventIDs   []string
+	// roles by counter ID, then subject
+	members map[string]map[string]pbmember.Role
+	// by code hash
+	invites map[string]Invite
+	// by secret hash
+	keys map[string]*pbkey.Key
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		now:      time.Now,
+		counters: map[string]*pbcounter.Counter{},
+		events:   map[string]*pbevent.Event{},
+		members:  map[string]map[string]pbmember.Role{},
+		invites:  map[string]Invite{},
+		keys:     map[string]*pbkey.Key{},
+	}
+}
+
+// SetClock replaces time.Now as the source of counter timestamps and event
+// times, so tests can control the durations between events.
+func (s *MemoryStore) SetClock(now func() time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.now = now
+}
+
+func (s *MemoryStore) CreateCounter(ctx context.Context, owner, title, eventTitle string) (*pbcounter.Counter, *pbevent.Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := timestamppb.New(s.now())
+	c := &pbcounter.Counter{Id: newUUID(), Title: title, Timestamp: now, Owner: owner}
+	e := &pbevent.Event{Id: newUUID(), Title: eventTitle, Duration: durationpb.New(0), CreatedAt: now, CounterId: c.Id, Owner: owner, CreatedBy: owner}
+
+	s.counters[c.Id] = c
+	s.members[c.Id] = map[string]pbmember.Role{owner: pbmember.Role_ROLE_OWNER}
+	s.counterIDs = append(s.counterIDs, c.Id)
+	s.events[e.Id] = e
+	s.eventIDs = append(s.eventIDs, e.Id)
+
+	return clone(c), clone(e), nil
+}
+
+func (s *MemoryStore) GetCounter(ctx context.Context, id string) (*pbcounter.Counter, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.counters[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return clone(c), nil
+}
+
+func (s *MemoryStore) IncrementCounter(ctx context.Context, id, createdBy, eventTitle string) (*pbcounter.Counter, *pbevent.Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.counters[id]
+	if !ok {
+		return nil, nil, ErrNotFound
+	}
+
+	var prev time.Time
+	for _, e := range s.events {
+		if t := e.CreatedAt.AsTime(); e.CounterId == id && t.After(prev) {
+			prev = t
+		}
+	}
+
+	now := s.now()
+	c.Count++
+	c.Timestamp = timestamppb.New(now)
+
+	e := &pbevent.Event{
+		Id:        newUUID(),
+		Title:     eventTitle,
+		Duration:  durationpb.New(now.Sub(prev)),
+		CreatedAt: timestamppb.New(now),
+		CounterId: id,
+		Owner:     c.Owner,
+		CreatedBy: createdBy,
+	}
+	s.events[e.Id] = e
+	s.eventIDs = append(s.eventIDs, e.Id)
+
+	return clone(c), clone(e), nil
+}
+
+func (s *MemoryStore) DeleteCounter(ctx context.Context, id string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.counters[id]; !ok {
+		return nil, ErrNotFound
+	}
+
+	deleted := []string{}
+	remaining := s.eventIDs[:0]
+	for _, eventID := range s.eventIDs {
+		if s.events[eventID].CounterId == id {
+			deleted = append(deleted, eventID)
+			delete(s.events, eventID)
+		} else {
+			remaining = append(remaining, eventID)
+		}
+	}
+	s.eventIDs = remaining
+
+	delete(s.counters, id)
+	s.counterIDs = removeID(s.counterIDs, id)
+	delete(s.members, id)
+	for hash, invite := range s.invites {
+		if invite.CounterID == id {
+			delete(s.invites, hash)
+		}
+	}
+
+	return deleted, nil
+}
+
+func (s *MemoryStore) GetEvent(ctx context.Context, id string) (*pbevent.Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.events[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return clone(e), nil
+}
+
+func (s *MemoryStore) ListEventIDs(ctx context.Context, counterID string) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.counters[counterID]; !ok {
+		return nil, ErrNotFound
+	}
+
+	ids := []string{}
+	for _, id := range s.eventIDs {
+		if s.events[id].CounterId == counterID {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (s *MemoryStore) CountCounters(ctx context.Context, owner string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int
+	for _, c := range s.counters {
+		if c.Owner == owner {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *MemoryStore) CountEvents(ctx context.Context, counterID string, since time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int
+	for _, e := range s.events {
+		if e.CounterId == counterID && !e.CreatedAt.AsTime().Before(since) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *MemoryStore) GetAccess(ctx context.Context, counterID, subject string) (*Access, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	role, ok := s.members[counterID][subject]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &Access{CounterID: counterID, Owner: s.counters[counterID].Owner, Role: role}, nil
+}
+
+func (s *MemoryStore) ListAccess(ctx context.Context, subject string) ([]*Access, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	access := []*Access{}
+	for _, id := range s.counterIDs {
+		if role, ok := s.members[id][subject]; ok {
+			access = append(access, &Access{CounterID: id, Owner: s.counters[id].Owner, Role: role})
+		}
+	}
+	return access, nil
+}
+
+func (s *MemoryStore) ListMembers(ctx context.Context, counterID string) ([]*pbmember.Member, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	members := []*pbmember.Member{}
+	for subject, role := range s.members[counterID] {
+		members = append(members, &pbmember.Member{CounterId: counterID, Subject: subject, Role: role})
+	}
+	slices.SortFunc(members, func(a, b *pbmember.Member) int {
+		return strings.Compare(a.Subject, b.Subject)
+	})
+	return members, nil
+}
+
+func (s *MemoryStore) SetMember(ctx context.Context, m *pbmember.Member) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	members, ok := s.members[m.CounterId]
+	if !ok {
+		return ErrNotFound
+	}
+	if members[m.Subject] == pbmember.Role_ROLE_OWNER && m.Role != pbmember.Role_ROLE_OWNER && owners(members) == 1 {
+		return ErrLastOwner
+	}
+	members[m.Subject] = m.Role
+	return nil
+}
+
+func (s *MemoryStore) RemoveMember(ctx context.Context, counterID, subject string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	role, ok := s.members[counterID][subject]
+	if !ok {
+		return ErrNotFound
+	}
+	if role == pbmember.Role_ROLE_OWNER && owners(s.members[counterID]) == 1 {
+		return ErrLastOwner
+	}
+	delete(s.members[counterID], subject)
+	return nil
+}
+
+func (s *MemoryStore) CreateInvite(ctx context.Context, codeHash string, invite *Invite) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.counters[invite.CounterID]; !ok {
+		return ErrNotFound
+	}
+	s.invites[codeHash] = *invite
+	return nil
+}
+
+func (s *MemoryStore) AcceptInvite(ctx context.Context, codeHash, subject string) (*pbmember.Member, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	invite, ok := s.invites[codeHash]
+	if !ok || !invite.ExpiresAt.After(s.now()) {
+		return nil, ErrNotFound
+	}
+	delete(s.invites, codeHash)
+
+	members := s.members[invite.CounterID]
+	members[subject] = max(members[subject], invite.Role)
+	return &pbmember.Member{CounterId: invite.CounterID, Subject: subject, Role: members[subject]}, nil
+}
+
+func (s *MemoryStore) CreateKey(ctx context.Context, secretHash string, key *pbkey.Key) (*pbkey.Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k := clone(key)
+	k.Id = newUUID()
+	k.CreatedAt = timestamppb.New(s.now())
+	s.keys[secretHash] = k
+	return clone(k), nil
+}
+
+func (s *MemoryStore) GetKey(ctx context.Context, secretHash string) (*pbkey.Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	k, ok := s.keys[secretHash]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return clone(k), nil
+}
+
+func (s *MemoryStore) ListKeys(ctx context.Context, subject string) ([]*pbkey.Key, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keys := []*pbkey.Key{}
+	for _, k := range s.keys {
+		if k.Subject == subject {
+			keys = append(keys, clone(k))
+		}
+	}
+	slices.SortFunc(keys, func(a, b *pbkey.Key) int {
+		if c := a.CreatedAt.AsTime().Compare(b.CreatedAt.AsTime()); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Id, b.Id)
+	})
+	return keys, nil
+}
+
+func (s *MemoryStore) DeleteKey(ctx context.Context, subject, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for hash, k := range s.keys {
+		if k.Id == id && k.Subject == subject {
+			delete(s.keys, hash)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (s *MemoryStore) TouchKey(ctx context.Context, id string, usedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, k := range s.keys {
+		if k.Id == id {
+			k.LastUsedAt = timestamppb.New(usedAt)
+		}
+	}
+	return nil
+}
+
+// How many of members are owners.
+func owners(members map[string]pbmember.Role) int {
+	n := 0
+	for _, role := range members {
+		if role == pbmember.Role_ROLE_OWNER {
+			n++
+		}
+	}
+	return n
+}
+
+func clone[T proto.Message](m T) T {
+	return proto.Clone(m).(T)
+}
+
+func removeID(ids []string, id string) []string {
+	for i := range ids {
+		if ids[i] == id {
+			return append(ids[:i], ids[i+1:]...)
+		}
+	}
+	return ids
+}
+
+// A random (version 4) UUID, like postgres' gen_random_uuid.
+func newUUID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
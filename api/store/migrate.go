@@ -0,0 +1,287 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Each migration is a pair of files, NNNN_name.up.sql and NNNN_name.down.sql,
+// applied in order of NNNN. There's a directory of them for each database,
+// which should be kept in step. Once a migration has been deployed it must not
+// be edited, add a new one instead.
+//
+//go:embed migrations
+var migrationFiles embed.FS
+
+// Key for the postgres advisory lock held while migrating, so replicas
+// starting at the same time take turns. Any value works as long as nothing
+// else using the database picks it.
+const migrationLockKey = 0x636f756e74657273 // "counters"
+
+// What differs between databases when migrating.
+type migrationDialect struct {
+	dir          string
+	createTable  string
+	lock, unlock string // empty if the database doesn't need locking
+}
+
+var migrationDialects = map[string]migrationDialect{
+	"postgres": {
+		dir: "migrations/postgres",
+		createTable: `CREATE TABLE IF NOT EXISTS schema_migrations (
+			version BIGINT PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL
+		)`,
+		lock:   fmt.Sprintf("SELECT pg_advisory_lock(%d)", migrationLockKey),
+		unlock: fmt.Sprintf("SELECT pg_advisory_unlock(%d)", migrationLockKey),
+	},
+	// only one process uses the file, and SQLite locks it while a migration's
+	// transaction is running anyway
+	"sqlite": {
+		dir: "migrations/sqlite",
+		createTable: `CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMP NOT NULL
+		)`,
+	},
+}
+
+type migration struct {
+	version int
+	name    string
+	up      string
+	down    string
+}
+
+// A migration and when it was applied, which is zero if it hasn't been.
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt time.Time
+}
+
+// Applies the migrations embedded in the binary, recording which have run in
+// the schema_migrations table.
+type Migrator struct {
+	db         *sql.DB
+	dialect    migrationDialect
+	migrations []migration
+}
+
+// NewMigrator migrates db, which was opened with the given driver, postgres
+// or sqlite.
+func NewMigrator(db *sql.DB, driver string) (*Migrator, error) {
+	dialect, ok := migrationDialects[driver]
+	if !ok {
+		return nil, fmt.Errorf("no migrations for %s", driver)
+	}
+
+	migrations, err := loadMigrations(migrationFiles, dialect.dir)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, dialect: dialect, migrations: migrations}, nil
+}
+
+func loadMigrations(fsys fs.FS, dir string) ([]migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*migration{}
+	for _, entry := range entries {
+		base, direction, ok := strings.Cut(strings.TrimSuffix(entry.Name(), ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("migration %s: expected NNNN_name.up.sql or NNNN_name.down.sql", entry.Name())
+		}
+		prefix, name, _ := strings.Cut(base, "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("migration %s: invalid version %q", entry.Name(), prefix)
+		}
+
+		b, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &migration{version: version, name: name}
+			byVersion[version] = m
+		} else if m.name != name {
+			return nil, fmt.Errorf("migration %d is named both %q and %q", version, m.name, name)
+		}
+		if direction == "up" {
+			m.up = string(b)
+		} else {
+			m.down = string(b)
+		}
+	}
+
+	migrations := make([]migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" || m.down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", m.version, m.name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].version < migrations[j].version })
+
+	return migrations, nil
+}
+
+// Up applies every migration which hasn't been yet, returning how many it
+// applied.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	applied := 0
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		done, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range m.migrations {
+			if _, ok := done[mig.version]; ok {
+				continue
+			}
+			if err := runMigration(ctx, conn, mig.up,
+				"INSERT INTO schema_migrations(version, name, applied_at) VALUES($1, $2, $3)", mig.version, mig.name, time.Now().UTC()); err != nil {
+				return fmt.Errorf("applying migration %d_%s: %w", mig.version, mig.name, err)
+			}
+			slog.InfoContext(ctx, "Applied migration", "version", mig.version, "name", mig.name)
+			applied++
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down reverts the latest steps migrations which have been applied, returning
+// how many it reverted.
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	reverted := 0
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		done, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(m.migrations) - 1; i >= 0 && reverted < steps; i-- {
+			mig := m.migrations[i]
+			if _, ok := done[mig.version]; !ok {
+				continue
+			}
+			if err := runMigration(ctx, conn, mig.down,
+				"DELETE FROM schema_migrations WHERE version = $1", mig.version); err != nil {
+				return fmt.Errorf("reverting migration %d_%s: %w", mig.version, mig.name, err)
+			}
+			slog.InfoContext(ctx, "Reverted migration", "version", mig.version, "name", mig.name)
+			reverted++
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Status lists every migration in the binary, plus any which were applied by
+// a newer one.
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		done, err := appliedMigrations(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, mig := range m.migrations {
+			statuses = append(statuses, MigrationStatus{Version: mig.version, Name: mig.name, AppliedAt: done[mig.version].AppliedAt})
+			delete(done, mig.version)
+		}
+		for _, unknown := range done {
+			statuses = append(statuses, unknown)
+		}
+		return nil
+	})
+
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, err
+}
+
+// Runs fn on a connection holding the migration lock, if the dialect has one,
+// after making sure the schema_migrations table exists. Advisory locks belong
+// to a session, so everything has to happen on the same connection.
+func (m *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if m.dialect.lock != "" {
+		if _, err := conn.ExecContext(ctx, m.dialect.lock); err != nil {
+			return fmt.Errorf("taking migration lock: %w", err)
+		}
+		defer func() {
+			// not ctx, which might be why we're returning
+			if _, err := conn.ExecContext(context.Background(), m.dialect.unlock); err != nil {
+				slog.ErrorContext(ctx, "Failed to release migration lock", "err", err)
+			}
+		}()
+	}
+
+	_, err = conn.ExecContext(ctx, m.dialect.createTable)
+	if err != nil {
+		return fmt.Errorf("creating schema_migrations: %w", err)
+	}
+
+	return fn(conn)
+}
+
+func appliedMigrations(ctx context.Context, conn *sql.Conn) (map[int]MigrationStatus, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, name, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[int]MigrationStatus{}
+	for rows.Next() {
+		var s MigrationStatus
+		if err := rows.Scan(&s.Version, &s.Name, &s.AppliedAt); err != nil {
+			return nil, err
+		}
+		applied[s.Version] = s
+	}
+	return applied, rows.Err()
+}
+
+// Runs a migration's SQL and the statement recording it in one transaction, so
+// a failure leaves neither behind.
+func runMigration(ctx context.Context, conn *sql.Conn, script, record string, args ...any) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,19 @@
+-- The schema the api has always assumed. IF NOT EXISTS lets databases which
+-- were set up by hand, before there were migrations, be adopted as they are.
+CREATE TABLE IF NOT EXISTS counters (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    title TEXT NOT NULL,
+    count INTEGER NOT NULL DEFAULT 0,
+    timestamp TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+-- duration is the time since the counter's previous event, in nanoseconds
+CREATE TABLE IF NOT EXISTS events (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    title TEXT NOT NULL,
+    duration BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    counter_id UUID NOT NULL REFERENCES counters (id)
+);
+
+CREATE INDEX IF NOT EXISTS events_counter_id_idx ON events (counter_id, created_at);
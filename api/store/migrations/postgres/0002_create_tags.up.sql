@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS tags (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    title TEXT NOT NULL,
+    counter_id UUID NOT NULL REFERENCES counters (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS tags_title_idx ON tags (title);
+CREATE INDEX IF NOT EXISTS tags_counter_id_idx ON tags (counter_id);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS counters_owner_idx;
+
+ALTER TABLE events DROP COLUMN IF EXISTS owner;
+ALTER TABLE counters DROP COLUMN IF EXISTS owner;
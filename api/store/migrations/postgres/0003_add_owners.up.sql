@@ -0,0 +1,7 @@
+-- Every counter belongs to the user who created it, the sub claim of their
+-- token, and its events belong to the same user. Rows from before there were
+-- users get '', which is who every caller is when auth is disabled.
+ALTER TABLE counters ADD COLUMN IF NOT EXISTS owner TEXT NOT NULL DEFAULT '';
+ALTER TABLE events ADD COLUMN IF NOT EXISTS owner TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS counters_owner_idx ON counters (owner);
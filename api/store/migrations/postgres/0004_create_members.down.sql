@@ -0,0 +1,4 @@
+ALTER TABLE events DROP COLUMN IF EXISTS created_by;
+
+DROP TABLE IF EXISTS invites;
+DROP TABLE IF EXISTS members;
@@ -0,0 +1,27 @@
+-- Who can do what with each counter, role being a member.v1.Role. Whoever
+-- created a counter owns it to begin with.
+CREATE TABLE IF NOT EXISTS members (
+    counter_id UUID NOT NULL REFERENCES counters (id) ON DELETE CASCADE,
+    subject TEXT NOT NULL,
+    role INTEGER NOT NULL,
+    PRIMARY KEY (counter_id, subject)
+);
+
+CREATE INDEX IF NOT EXISTS members_subject_idx ON members (subject);
+
+INSERT INTO members (counter_id, subject, role)
+SELECT id, owner, 3 FROM counters
+ON CONFLICT DO NOTHING;
+
+-- Only a hash of each code is kept, so they can't be read out of a backup.
+CREATE TABLE IF NOT EXISTS invites (
+    code_hash TEXT PRIMARY KEY,
+    counter_id UUID NOT NULL REFERENCES counters (id) ON DELETE CASCADE,
+    role INTEGER NOT NULL,
+    created_by TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+-- Until now only a counter's owner could increment it.
+ALTER TABLE events ADD COLUMN IF NOT EXISTS created_by TEXT NOT NULL DEFAULT '';
+UPDATE events SET created_by = owner;
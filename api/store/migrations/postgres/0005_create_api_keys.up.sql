@@ -0,0 +1,17 @@
+-- API keys, which act on behalf of subject. Only a hash of each secret is
+-- kept. scopes are key.v1.Scope names and counter_ids the only counters the
+-- key can be used with, both space separated. There's no foreign key to
+-- counters, so deleting one doesn't leave a key which can use any of them.
+CREATE TABLE IF NOT EXISTS api_keys (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    secret_hash TEXT NOT NULL UNIQUE,
+    subject TEXT NOT NULL,
+    name TEXT NOT NULL,
+    scopes TEXT NOT NULL,
+    counter_ids TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ,
+    last_used_at TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS api_keys_subject_idx ON api_keys (subject);
@@ -0,0 +1,19 @@
+-- The same schema as postgres, except that the api generates the ids and
+-- times, which are always UTC so that they sort as text.
+CREATE TABLE counters (
+    id TEXT PRIMARY KEY,
+    title TEXT NOT NULL,
+    count INTEGER NOT NULL DEFAULT 0,
+    timestamp TIMESTAMP NOT NULL
+);
+
+-- duration is the time since the counter's previous event, in nanoseconds
+CREATE TABLE events (
+    id TEXT PRIMARY KEY,
+    title TEXT NOT NULL,
+    duration INTEGER NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL,
+    counter_id TEXT NOT NULL REFERENCES counters (id)
+);
+
+CREATE INDEX events_counter_id_idx ON events (counter_id, created_at);
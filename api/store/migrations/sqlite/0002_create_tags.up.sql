@@ -0,0 +1,8 @@
+CREATE TABLE tags (
+    id TEXT PRIMARY KEY,
+    title TEXT NOT NULL,
+    counter_id TEXT NOT NULL REFERENCES counters (id) ON DELETE CASCADE
+);
+
+CREATE INDEX tags_title_idx ON tags (title);
+CREATE INDEX tags_counter_id_idx ON tags (counter_id);
@@ -0,0 +1,4 @@
+DROP INDEX counters_owner_idx;
+
+ALTER TABLE events DROP COLUMN owner;
+ALTER TABLE counters DROP COLUMN owner;
@@ -0,0 +1,5 @@
+-- See the postgres migration. '' is who every caller is when auth is disabled.
+ALTER TABLE counters ADD COLUMN owner TEXT NOT NULL DEFAULT '';
+ALTER TABLE events ADD COLUMN owner TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX counters_owner_idx ON counters (owner);
@@ -0,0 +1,4 @@
+ALTER TABLE events DROP COLUMN created_by;
+
+DROP TABLE invites;
+DROP TABLE members;
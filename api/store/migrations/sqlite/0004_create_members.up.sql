@@ -0,0 +1,23 @@
+-- See the postgres migration.
+CREATE TABLE members (
+    counter_id TEXT NOT NULL REFERENCES counters (id) ON DELETE CASCADE,
+    subject TEXT NOT NULL,
+    role INTEGER NOT NULL,
+    PRIMARY KEY (counter_id, subject)
+);
+
+CREATE INDEX members_subject_idx ON members (subject);
+
+INSERT INTO members (counter_id, subject, role)
+SELECT id, owner, 3 FROM counters;
+
+CREATE TABLE invites (
+    code_hash TEXT PRIMARY KEY,
+    counter_id TEXT NOT NULL REFERENCES counters (id) ON DELETE CASCADE,
+    role INTEGER NOT NULL,
+    created_by TEXT NOT NULL,
+    expires_at TIMESTAMP NOT NULL
+);
+
+ALTER TABLE events ADD COLUMN created_by TEXT NOT NULL DEFAULT '';
+UPDATE events SET created_by = owner;
@@ -0,0 +1,492 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/alextebbs/counters/internal/telemetry"
+	pbcounter "github.com/alextebbs/counters/pb/counter/v1"
+	pbevent "github.com/alextebbs/counters/pb/event/v1"
+	pbkey "github.com/alextebbs/counters/pb/key/v1"
+	pbmember "github.com/alextebbs/counters/pb/member/v1"
+)
+
+// A Store backed by the postgres schema in migrations/.
+type PostgresStore struct {
+	db *sql.DB
+}
+
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) CreateCounter(ctx context.Context, owner, title, eventTitle string) (*pbcounter.Counter, *pbevent.Event, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	_, span := telemetry.StartQuerySpan(ctx, "INSERT", "counters")
+	c, err := ScanCounter(tx.QueryRowContext(ctx,
+		"INSERT INTO counters(title, owner) VALUES($1, $2) RETURNING id, title, count, timestamp, owner",
+		title, owner))
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the first event doesn't have a duration - duration is a value on each
+	// event that actually refers to the interval of time between the event and
+	// the previous event. There is no previous event for the first event.
+	_, span = telemetry.StartQuerySpan(ctx, "INSERT", "events")
+	e, err := ScanEvent(tx.QueryRowContext(ctx,
+		"INSERT INTO events(title, counter_id, owner, created_by) VALUES($1, $2, $3, $3) RETURNING id, title, duration, created_at, counter_id, owner, created_by",
+		eventTitle, c.Id, owner))
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_, span = telemetry.StartQuerySpan(ctx, "INSERT", "members")
+	_, err = tx.ExecContext(ctx, "INSERT INTO members(counter_id, subject, role) VALUES($1, $2, $3)", c.Id, owner, pbmember.Role_ROLE_OWNER)
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := commit(ctx, tx, "counters"); err != nil {
+		return nil, nil, err
+	}
+	return c, e, nil
+}
+
+func (s *PostgresStore) GetCounter(ctx context.Context, id string) (*pbcounter.Counter, error) {
+	_, span := telemetry.StartQuerySpan(ctx, "SELECT", "counters")
+	c, err := ScanCounter(s.db.QueryRowContext(ctx, "SELECT id, title, count, timestamp, owner FROM counters WHERE id = $1", id))
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return c, nil
+}
+
+func (s *PostgresStore) IncrementCounter(ctx context.Context, id, createdBy, eventTitle string) (*pbcounter.Counter, *pbevent.Event, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	// 1. Find the last event's timestamp, the time between that and now will
+	// become the duration of the new event. MAX is NULL if the counter doesn't
+	// exist, in which case the UPDATE below finds no rows.
+	var prevEventTimeStamp sql.NullTime
+	_, span := telemetry.StartQuerySpan(ctx, "SELECT", "events")
+	err = tx.QueryRowContext(ctx, `SELECT MAX(created_at) FROM events WHERE counter_id = $1`, id).Scan(&prevEventTimeStamp)
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// 2. Increment the counter and get the new count and timestamp
+	_, span = telemetry.StartQuerySpan(ctx, "UPDATE", "counters")
+	c, err := ScanCounter(tx.QueryRowContext(ctx,
+		"UPDATE counters SET count = count + 1, timestamp = NOW() WHERE id = $1 RETURNING id, title, count, timestamp, owner",
+		id))
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		return nil, nil, notFound(err)
+	}
+
+	// 3. Add the new event with the calculated duration
+	var d time.Duration = time.Since(prevEventTimeStamp.Time)
+	_, span = telemetry.StartQuerySpan(ctx, "INSERT", "events")
+	e, err := ScanEvent(tx.QueryRowContext(ctx,
+		"INSERT INTO events(title, duration, counter_id, owner, created_by) VALUES($1, $2, $3, $4, $5) RETURNING id, title, duration, created_at, counter_id, owner, created_by",
+		eventTitle, d, c.Id, c.Owner, createdBy))
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := commit(ctx, tx, "counters"); err != nil {
+		return nil, nil, err
+	}
+	return c, e, nil
+}
+
+func (s *PostgresStore) DeleteCounter(ctx context.Context, id string) ([]string, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Get associated event IDs which the caller uses to invalidate the cache
+	_, span := telemetry.StartQuerySpan(ctx, "SELECT", "events")
+	rows, err := tx.QueryContext(ctx, "SELECT id FROM events WHERE counter_id = $1", id)
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		return nil, err
+	}
+	eventIDs, err := scanIDs(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	// Delete associated events, then the counter itself, which takes its
+	// members and invites with it
+	_, span = telemetry.StartQuerySpan(ctx, "DELETE", "events")
+	_, err = tx.ExecContext(ctx, "DELETE FROM events WHERE counter_id = $1", id)
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		return nil, err
+	}
+
+	var deleted string
+	_, span = telemetry.StartQuerySpan(ctx, "DELETE", "counters")
+	err = tx.QueryRowContext(ctx, "DELETE FROM counters WHERE id = $1 RETURNING id", id).Scan(&deleted)
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	if err := commit(ctx, tx, "counters"); err != nil {
+		return nil, err
+	}
+	return eventIDs, nil
+}
+
+func (s *PostgresStore) GetEvent(ctx context.Context, id string) (*pbevent.Event, error) {
+	_, span := telemetry.StartQuerySpan(ctx, "SELECT", "events")
+	e, err := ScanEvent(s.db.QueryRowContext(ctx, "SELECT id, title, duration, created_at, counter_id, owner, created_by FROM events WHERE id = $1", id))
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return e, nil
+}
+
+func (s *PostgresStore) ListEventIDs(ctx context.Context, counterID string) ([]string, error) {
+	if err := counterExists(ctx, s.db, counterID); err != nil {
+		return nil, err
+	}
+
+	// oldest first, which pagination relies on, with ids breaking ties as
+	// sqlite's rowids do
+	_, span := telemetry.StartQuerySpan(ctx, "SELECT", "events")
+	rows, err := s.db.QueryContext(ctx, "SELECT id FROM events WHERE counter_id = $1 ORDER BY created_at, id", counterID)
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		return nil, err
+	}
+	return scanIDs(rows)
+}
+
+func (s *PostgresStore) GetAccess(ctx context.Context, counterID, subject string) (*Access, error) {
+	_, span := telemetry.StartQuerySpan(ctx, "SELECT", "members")
+	a, err := scanAccess(s.db.QueryRowContext(ctx,
+		"SELECT counters.id, counters.owner, members.role FROM members JOIN counters ON counters.id = members.counter_id WHERE members.counter_id = $1 AND members.subject = $2",
+		counterID, subject))
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return a, nil
+}
+
+func (s *PostgresStore) ListAccess(ctx context.Context, subject string) ([]*Access, error) {
+	// oldest first, like ListEventIDs. Counters don't record when they were
+	// created, but their first event is added in the same transaction.
+	_, span := telemetry.StartQuerySpan(ctx, "SELECT", "members")
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT counters.id, counters.owner, members.role FROM members JOIN counters ON counters.id = members.counter_id WHERE members.subject = $1 ORDER BY (SELECT MIN(created_at) FROM events WHERE events.counter_id = counters.id), counters.id",
+		subject)
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		return nil, err
+	}
+	return scanAll(rows, scanAccess)
+}
+
+func (s *PostgresStore) ListMembers(ctx context.Context, counterID string) ([]*pbmember.Member, error) {
+	return listMembers(ctx, s.db, counterID)
+}
+
+func (s *PostgresStore) SetMember(ctx context.Context, m *pbmember.Member) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockCounter(ctx, tx, m.CounterId); err != nil {
+		return err
+	}
+
+	_, span := telemetry.StartQuerySpan(ctx, "INSERT", "members")
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO members(counter_id, subject, role) VALUES($1, $2, $3) ON CONFLICT (counter_id, subject) DO UPDATE SET role = EXCLUDED.role",
+		m.CounterId, m.Subject, m.Role)
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		return err
+	}
+
+	if err := checkOwner(ctx, tx, m.CounterId); err != nil {
+		return err
+	}
+	return commit(ctx, tx, "members")
+}
+
+func (s *PostgresStore) RemoveMember(ctx context.Context, counterID, subject string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := lockCounter(ctx, tx, counterID); err != nil {
+		return err
+	}
+	if err := deleteMember(ctx, tx, counterID, subject); err != nil {
+		return err
+	}
+	if err := checkOwner(ctx, tx, counterID); err != nil {
+		return err
+	}
+	return commit(ctx, tx, "members")
+}
+
+func (s *PostgresStore) CreateInvite(ctx context.Context, codeHash string, invite *Invite) error {
+	return createInvite(ctx, s.db, codeHash, invite)
+}
+
+func (s *PostgresStore) AcceptInvite(ctx context.Context, codeHash, subject string) (*pbmember.Member, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// deleting the invite as it's read means it can only be accepted once,
+	// however many callers race for it
+	var counterID string
+	var role pbmember.Role
+	_, span := telemetry.StartQuerySpan(ctx, "DELETE", "invites")
+	err = tx.QueryRowContext(ctx,
+		"DELETE FROM invites WHERE code_hash = $1 AND expires_at > NOW() RETURNING counter_id, role",
+		codeHash).Scan(&counterID, &role)
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	_, span = telemetry.StartQuerySpan(ctx, "INSERT", "members")
+	m, err := scanMember(tx.QueryRowContext(ctx,
+		"INSERT INTO members(counter_id, subject, role) VALUES($1, $2, $3) ON CONFLICT (counter_id, subject) DO UPDATE SET role = GREATEST(members.role, EXCLUDED.role) RETURNING counter_id, subject, role",
+		counterID, subject, role))
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := commit(ctx, tx, "members"); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (s *PostgresStore) CountCounters(ctx context.Context, owner string) (int, error) {
+	return countCounters(ctx, s.db, owner)
+}
+
+func (s *PostgresStore) CountEvents(ctx context.Context, counterID string, since time.Time) (int, error) {
+	return countEvents(ctx, s.db, counterID, since)
+}
+
+func (s *PostgresStore) CreateKey(ctx context.Context, secretHash string, key *pbkey.Key) (*pbkey.Key, error) {
+	_, span := telemetry.StartQuerySpan(ctx, "INSERT", "api_keys")
+	k, err := scanKey(s.db.QueryRowContext(ctx,
+		"INSERT INTO api_keys(secret_hash, subject, name, scopes, counter_ids, expires_at) VALUES($1, $2, $3, $4, $5, $6) RETURNING "+keyColumns,
+		secretHash, key.Subject, key.Name, joinScopes(key.Scopes), strings.Join(key.CounterIds, " "), nullTime(key.ExpiresAt)))
+	telemetry.EndSpan(span, err)
+	return k, err
+}
+
+func (s *PostgresStore) GetKey(ctx context.Context, secretHash string) (*pbkey.Key, error) {
+	return getKey(ctx, s.db, secretHash)
+}
+
+func (s *PostgresStore) ListKeys(ctx context.Context, subject string) ([]*pbkey.Key, error) {
+	return listKeys(ctx, s.db, subject)
+}
+
+func (s *PostgresStore) DeleteKey(ctx context.Context, subject, id string) error {
+	return deleteKey(ctx, s.db, subject, id)
+}
+
+func (s *PostgresStore) TouchKey(ctx context.Context, id string, usedAt time.Time) error {
+	return touchKey(ctx, s.db, id, usedAt)
+}
+
+func commit(ctx context.Context, tx *sql.Tx, table string) error {
+	_, span := telemetry.StartQuerySpan(ctx, "COMMIT", table)
+	err := tx.Commit()
+	telemetry.EndSpan(span, err)
+	return err
+}
+
+func countCounters(ctx context.Context, db *sql.DB, owner string) (int, error) {
+	var n int
+	_, span := telemetry.StartQuerySpan(ctx, "SELECT", "counters")
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM counters WHERE owner = $1", owner).Scan(&n)
+	telemetry.EndSpan(span, err)
+	return n, err
+}
+
+func countEvents(ctx context.Context, db *sql.DB, counterID string, since time.Time) (int, error) {
+	var n int
+	_, span := telemetry.StartQuerySpan(ctx, "SELECT", "events")
+	err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM events WHERE counter_id = $1 AND created_at >= $2", counterID, since.UTC()).Scan(&n)
+	telemetry.EndSpan(span, err)
+	return n, err
+}
+
+// Returns ErrNotFound unless there's a counter with id, so listing the events
+// of a missing counter doesn't look like it has none.
+func counterExists(ctx context.Context, db *sql.DB, id string) error {
+	var exists bool
+	_, span := telemetry.StartQuerySpan(ctx, "SELECT", "counters")
+	err := db.QueryRowContext(ctx, "SELECT EXISTS(SELECT 1 FROM counters WHERE id = $1)", id).Scan(&exists)
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Locks a counter's row until tx ends, so concurrent changes to its members
+// can't both see another owner and remove them from each other.
+func lockCounter(ctx context.Context, tx *sql.Tx, id string) error {
+	var locked string
+	_, span := telemetry.StartQuerySpan(ctx, "SELECT", "counters")
+	err := tx.QueryRowContext(ctx, "SELECT id FROM counters WHERE id = $1 FOR UPDATE", id).Scan(&locked)
+	telemetry.EndSpan(span, err)
+	return notFound(err)
+}
+
+// The rest of the members queries are the same for postgres and SQLite.
+
+func listMembers(ctx context.Context, db *sql.DB, counterID string) ([]*pbmember.Member, error) {
+	_, span := telemetry.StartQuerySpan(ctx, "SELECT", "members")
+	rows, err := db.QueryContext(ctx, "SELECT counter_id, subject, role FROM members WHERE counter_id = $1 ORDER BY subject", counterID)
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		return nil, err
+	}
+	return scanAll(rows, scanMember)
+}
+
+func deleteMember(ctx context.Context, tx *sql.Tx, counterID, subject string) error {
+	var deleted string
+	_, span := telemetry.StartQuerySpan(ctx, "DELETE", "members")
+	err := tx.QueryRowContext(ctx, "DELETE FROM members WHERE counter_id = $1 AND subject = $2 RETURNING subject", counterID, subject).Scan(&deleted)
+	telemetry.EndSpan(span, err)
+	return notFound(err)
+}
+
+// Returns ErrLastOwner if a change in tx has left a counter without an owner,
+// before it's committed.
+func checkOwner(ctx context.Context, tx *sql.Tx, counterID string) error {
+	var owners int
+	_, span := telemetry.StartQuerySpan(ctx, "SELECT", "members")
+	err := tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM members WHERE counter_id = $1 AND role = $2", counterID, pbmember.Role_ROLE_OWNER).Scan(&owners)
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		return err
+	}
+	if owners == 0 {
+		return ErrLastOwner
+	}
+	return nil
+}
+
+func createInvite(ctx context.Context, db *sql.DB, codeHash string, invite *Invite) error {
+	_, span := telemetry.StartQuerySpan(ctx, "INSERT", "invites")
+	_, err := db.ExecContext(ctx,
+		"INSERT INTO invites(code_hash, counter_id, role, created_by, expires_at) VALUES($1, $2, $3, $4, $5)",
+		codeHash, invite.CounterID, invite.Role, invite.CreatedBy, invite.ExpiresAt.UTC())
+	telemetry.EndSpan(span, err)
+	return err
+}
+
+// The rest of the api_keys queries are the same for postgres and SQLite too.
+
+const keyColumns = "id, name, subject, scopes, counter_ids, created_at, expires_at, last_used_at"
+
+func getKey(ctx context.Context, db *sql.DB, secretHash string) (*pbkey.Key, error) {
+	_, span := telemetry.StartQuerySpan(ctx, "SELECT", "api_keys")
+	k, err := scanKey(db.QueryRowContext(ctx, "SELECT "+keyColumns+" FROM api_keys WHERE secret_hash = $1", secretHash))
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return k, nil
+}
+
+func listKeys(ctx context.Context, db *sql.DB, subject string) ([]*pbkey.Key, error) {
+	_, span := telemetry.StartQuerySpan(ctx, "SELECT", "api_keys")
+	rows, err := db.QueryContext(ctx, "SELECT "+keyColumns+" FROM api_keys WHERE subject = $1 ORDER BY created_at, id", subject)
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		return nil, err
+	}
+	return scanAll(rows, scanKey)
+}
+
+func deleteKey(ctx context.Context, db *sql.DB, subject, id string) error {
+	var deleted string
+	_, span := telemetry.StartQuerySpan(ctx, "DELETE", "api_keys")
+	err := db.QueryRowContext(ctx, "DELETE FROM api_keys WHERE id = $1 AND subject = $2 RETURNING id", id, subject).Scan(&deleted)
+	telemetry.EndSpan(span, err)
+	return notFound(err)
+}
+
+func touchKey(ctx context.Context, db *sql.DB, id string, usedAt time.Time) error {
+	_, span := telemetry.StartQuerySpan(ctx, "UPDATE", "api_keys")
+	_, err := db.ExecContext(ctx, "UPDATE api_keys SET last_used_at = $1 WHERE id = $2", usedAt.UTC(), id)
+	telemetry.EndSpan(span, err)
+	return err
+}
+
+// Reads a single id column from every row and closes rows.
+func scanIDs(rows *sql.Rows) ([]string, error) {
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// Turns a missing row into ErrNotFound, which is what callers of a store
+// expect.
+func notFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
@@ -0,0 +1,129 @@
+package store
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	pbcounter "github.com/alextebbs/counters/pb/counter/v1"
+	pbevent "github.com/alextebbs/counters/pb/event/v1"
+	pbkey "github.com/alextebbs/counters/pb/key/v1"
+	pbmember "github.com/alextebbs/counters/pb/member/v1"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Either a *sql.Row or *sql.Rows.
+type RowScanner interface {
+	Scan(dest ...any) error
+}
+
+// Scans the columns id, title, count, timestamp, owner into a counter.
+// Exported for the cache tools, which read the counters table directly.
+func ScanCounter(row RowScanner) (*pbcounter.Counter, error) {
+	var c pbcounter.Counter
+	var t time.Time
+	if err := row.Scan(&c.Id, &c.Title, &c.Count, &t, &c.Owner); err != nil {
+		return nil, err
+	}
+	c.Timestamp = timestamppb.New(t)
+	return &c, nil
+}
+
+// Scans the columns id, title, duration, created_at, counter_id, owner,
+// created_by into an event.
+func ScanEvent(row RowScanner) (*pbevent.Event, error) {
+	var e pbevent.Event
+	var d int64
+	var t time.Time
+	if err := row.Scan(&e.Id, &e.Title, &d, &t, &e.CounterId, &e.Owner, &e.CreatedBy); err != nil {
+		return nil, err
+	}
+	e.Duration = durationpb.New(time.Duration(d))
+	e.CreatedAt = timestamppb.New(t)
+	return &e, nil
+}
+
+// Scans every row with scan and closes rows.
+func scanAll[T any](rows *sql.Rows, scan func(RowScanner) (T, error)) ([]T, error) {
+	defer rows.Close()
+
+	all := []T{}
+	for rows.Next() {
+		v, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, v)
+	}
+	return all, rows.Err()
+}
+
+// Scans the columns counter_id, owner, role into an Access.
+func scanAccess(row RowScanner) (*Access, error) {
+	var a Access
+	if err := row.Scan(&a.CounterID, &a.Owner, &a.Role); err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// Scans the columns counter_id, subject, role into a member.
+func scanMember(row RowScanner) (*pbmember.Member, error) {
+	var m pbmember.Member
+	if err := row.Scan(&m.CounterId, &m.Subject, &m.Role); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// Scans the columns id, name, subject, scopes, counter_ids, created_at,
+// expires_at, last_used_at into a key.
+func scanKey(row RowScanner) (*pbkey.Key, error) {
+	var k pbkey.Key
+	var scopes, counterIDs string
+	var createdAt time.Time
+	var expiresAt, lastUsedAt sql.NullTime
+	if err := row.Scan(&k.Id, &k.Name, &k.Subject, &scopes, &counterIDs, &createdAt, &expiresAt, &lastUsedAt); err != nil {
+		return nil, err
+	}
+	k.Scopes = splitScopes(scopes)
+	k.CounterIds = strings.Fields(counterIDs)
+	k.CreatedAt = timestamppb.New(createdAt)
+	if expiresAt.Valid {
+		k.ExpiresAt = timestamppb.New(expiresAt.Time)
+	}
+	if lastUsedAt.Valid {
+		k.LastUsedAt = timestamppb.New(lastUsedAt.Time)
+	}
+	return &k, nil
+}
+
+// The scopes column, e.g. "SCOPE_READ SCOPE_INCREMENT".
+func joinScopes(scopes []pbkey.Scope) string {
+	names := make([]string, len(scopes))
+	for i, scope := range scopes {
+		names[i] = scope.String()
+	}
+	return strings.Join(names, " ")
+}
+
+// Names which aren't scopes any more are dropped rather than failing, so
+// removing a scope takes it away from every key.
+func splitScopes(column string) []pbkey.Scope {
+	var scopes []pbkey.Scope
+	for _, name := range strings.Fields(column) {
+		if v, ok := pbkey.Scope_value[name]; ok {
+			scopes = append(scopes, pbkey.Scope(v))
+		}
+	}
+	return scopes
+}
+
+// A NULL for an unset timestamp.
+func nullTime(t *timestamppb.Timestamp) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: t.AsTime(), Valid: true}
+}
@@ -0,0 +1,358 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/alextebbs/counters/internal/telemetry"
+	pbcounter "github.com/alextebbs/counters/pb/counter/v1"
+	pbevent "github.com/alextebbs/counters/pb/event/v1"
+	pbkey "github.com/alextebbs/counters/pb/key/v1"
+	pbmember "github.com/alextebbs/counters/pb/member/v1"
+
+	_ "modernc.org/sqlite"
+)
+
+// A Store backed by a SQLite file, for running the api
+// on its own. The schema mirrors postgres, but SQLite can't generate uuids so
+// ids and times come from here instead.
+type SQLiteStore struct {
+	db  *sql.DB
+	now func() time.Time
+}
+
+func NewSQLiteStore(db *sql.DB) *SQLiteStore {
+	return &SQLiteStore{db: db, now: time.Now}
+}
+
+// SetClock replaces time.Now as the source of counter and event times, see
+// MemoryStore.SetClock. It must be called before the store is used.
+func (s *SQLiteStore) SetClock(now func() time.Time) {
+	s.now = now
+}
+
+// Opens the SQLite file at path, creating it if needed.
+func OpenSQLite(path string) (*sql.DB, error) {
+	// foreign keys are off by default, and the busy timeout saves the migrate
+	// command from failing while the server is writing.
+	dsn := fmt.Sprintf("file:%s?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)", url.PathEscape(path))
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite only allows one writer at a time, and a transaction which starts
+	// out reading can't wait its turn to write, so one connection avoids
+	// SQLITE_BUSY errors entirely.
+	db.SetMaxOpenConns(1)
+
+	return db, nil
+}
+
+func (s *SQLiteStore) CreateCounter(ctx context.Context, owner, title, eventTitle string) (*pbcounter.Counter, *pbevent.Event, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	now := s.now().UTC()
+
+	_, span := telemetry.StartQuerySpan(ctx, "INSERT", "counters")
+	c, err := ScanCounter(tx.QueryRowContext(ctx,
+		"INSERT INTO counters(id, title, timestamp, owner) VALUES($1, $2, $3, $4) RETURNING id, title, count, timestamp, owner",
+		newUUID(), title, now, owner))
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// the first event has no previous event to measure a duration from
+	_, span = telemetry.StartQuerySpan(ctx, "INSERT", "events")
+	e, err := ScanEvent(tx.QueryRowContext(ctx,
+		"INSERT INTO events(id, title, created_at, counter_id, owner, created_by) VALUES($1, $2, $3, $4, $5, $5) RETURNING id, title, duration, created_at, counter_id, owner, created_by",
+		newUUID(), eventTitle, now, c.Id, owner))
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_, span = telemetry.StartQuerySpan(ctx, "INSERT", "members")
+	_, err = tx.ExecContext(ctx, "INSERT INTO members(counter_id, subject, role) VALUES($1, $2, $3)", c.Id, owner, pbmember.Role_ROLE_OWNER)
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := commit(ctx, tx, "counters"); err != nil {
+		return nil, nil, err
+	}
+	return c, e, nil
+}
+
+func (s *SQLiteStore) GetCounter(ctx context.Context, id string) (*pbcounter.Counter, error) {
+	_, span := telemetry.StartQuerySpan(ctx, "SELECT", "counters")
+	c, err := ScanCounter(s.db.QueryRowContext(ctx, "SELECT id, title, count, timestamp, owner FROM counters WHERE id = $1", id))
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return c, nil
+}
+
+func (s *SQLiteStore) IncrementCounter(ctx context.Context, id, createdBy, eventTitle string) (*pbcounter.Counter, *pbevent.Event, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback()
+
+	// The counter's timestamp is always the same as the created_at of its
+	// latest event, since both are set from the same now, so the new event's
+	// duration can be measured from it.
+	var prev time.Time
+	_, span := telemetry.StartQuerySpan(ctx, "SELECT", "counters")
+	err = tx.QueryRowContext(ctx, "SELECT timestamp FROM counters WHERE id = $1", id).Scan(&prev)
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		return nil, nil, notFound(err)
+	}
+
+	now := s.now().UTC()
+
+	_, span = telemetry.StartQuerySpan(ctx, "UPDATE", "counters")
+	c, err := ScanCounter(tx.QueryRowContext(ctx,
+		"UPDATE counters SET count = count + 1, timestamp = $1 WHERE id = $2 RETURNING id, title, count, timestamp, owner",
+		now, id))
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		return nil, nil, notFound(err)
+	}
+
+	_, span = telemetry.StartQuerySpan(ctx, "INSERT", "events")
+	e, err := ScanEvent(tx.QueryRowContext(ctx,
+		"INSERT INTO events(id, title, duration, created_at, counter_id, owner, created_by) VALUES($1, $2, $3, $4, $5, $6, $7) RETURNING id, title, duration, created_at, counter_id, owner, created_by",
+		newUUID(), eventTitle, int64(now.Sub(prev)), now, c.Id, c.Owner, createdBy))
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := commit(ctx, tx, "counters"); err != nil {
+		return nil, nil, err
+	}
+	return c, e, nil
+}
+
+func (s *SQLiteStore) DeleteCounter(ctx context.Context, id string) ([]string, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	_, span := telemetry.StartQuerySpan(ctx, "SELECT", "events")
+	rows, err := tx.QueryContext(ctx, "SELECT id FROM events WHERE counter_id = $1", id)
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		return nil, err
+	}
+	eventIDs, err := scanIDs(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	_, span = telemetry.StartQuerySpan(ctx, "DELETE", "events")
+	_, err = tx.ExecContext(ctx, "DELETE FROM events WHERE counter_id = $1", id)
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		return nil, err
+	}
+
+	var deleted string
+	_, span = telemetry.StartQuerySpan(ctx, "DELETE", "counters")
+	err = tx.QueryRowContext(ctx, "DELETE FROM counters WHERE id = $1 RETURNING id", id).Scan(&deleted)
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	if err := commit(ctx, tx, "counters"); err != nil {
+		return nil, err
+	}
+	return eventIDs, nil
+}
+
+func (s *SQLiteStore) GetEvent(ctx context.Context, id string) (*pbevent.Event, error) {
+	_, span := telemetry.StartQuerySpan(ctx, "SELECT", "events")
+	e, err := ScanEvent(s.db.QueryRowContext(ctx, "SELECT id, title, duration, created_at, counter_id, owner, created_by FROM events WHERE id = $1", id))
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return e, nil
+}
+
+func (s *SQLiteStore) ListEventIDs(ctx context.Context, counterID string) ([]string, error) {
+	if err := counterExists(ctx, s.db, counterID); err != nil {
+		return nil, err
+	}
+
+	_, span := telemetry.StartQuerySpan(ctx, "SELECT", "events")
+	rows, err := s.db.QueryContext(ctx, "SELECT id FROM events WHERE counter_id = $1 ORDER BY created_at, rowid", counterID)
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		return nil, err
+	}
+	return scanIDs(rows)
+}
+
+func (s *SQLiteStore) CountCounters(ctx context.Context, owner string) (int, error) {
+	return countCounters(ctx, s.db, owner)
+}
+
+func (s *SQLiteStore) CountEvents(ctx context.Context, counterID string, since time.Time) (int, error) {
+	return countEvents(ctx, s.db, counterID, since)
+}
+
+func (s *SQLiteStore) GetAccess(ctx context.Context, counterID, subject string) (*Access, error) {
+	_, span := telemetry.StartQuerySpan(ctx, "SELECT", "members")
+	a, err := scanAccess(s.db.QueryRowContext(ctx,
+		"SELECT counters.id, counters.owner, members.role FROM members JOIN counters ON counters.id = members.counter_id WHERE members.counter_id = $1 AND members.subject = $2",
+		counterID, subject))
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		return nil, notFound(err)
+	}
+	return a, nil
+}
+
+func (s *SQLiteStore) ListAccess(ctx context.Context, subject string) ([]*Access, error) {
+	_, span := telemetry.StartQuerySpan(ctx, "SELECT", "members")
+	rows, err := s.db.QueryContext(ctx,
+		"SELECT counters.id, counters.owner, members.role FROM members JOIN counters ON counters.id = members.counter_id WHERE members.subject = $1 ORDER BY counters.rowid",
+		subject)
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		return nil, err
+	}
+	return scanAll(rows, scanAccess)
+}
+
+func (s *SQLiteStore) ListMembers(ctx context.Context, counterID string) ([]*pbmember.Member, error) {
+	return listMembers(ctx, s.db, counterID)
+}
+
+// SQLite has no SELECT ... FOR UPDATE, but with a single connection nothing
+// else can change the members while a transaction is checking them.
+func (s *SQLiteStore) SetMember(ctx context.Context, m *pbmember.Member) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var id string
+	_, span := telemetry.StartQuerySpan(ctx, "SELECT", "counters")
+	err = tx.QueryRowContext(ctx, "SELECT id FROM counters WHERE id = $1", m.CounterId).Scan(&id)
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		return notFound(err)
+	}
+
+	_, span = telemetry.StartQuerySpan(ctx, "INSERT", "members")
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO members(counter_id, subject, role) VALUES($1, $2, $3) ON CONFLICT (counter_id, subject) DO UPDATE SET role = excluded.role",
+		m.CounterId, m.Subject, m.Role)
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		return err
+	}
+
+	if err := checkOwner(ctx, tx, m.CounterId); err != nil {
+		return err
+	}
+	return commit(ctx, tx, "members")
+}
+
+func (s *SQLiteStore) RemoveMember(ctx context.Context, counterID, subject string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := deleteMember(ctx, tx, counterID, subject); err != nil {
+		return err
+	}
+	if err := checkOwner(ctx, tx, counterID); err != nil {
+		return err
+	}
+	return commit(ctx, tx, "members")
+}
+
+func (s *SQLiteStore) CreateInvite(ctx context.Context, codeHash string, invite *Invite) error {
+	return createInvite(ctx, s.db, codeHash, invite)
+}
+
+func (s *SQLiteStore) AcceptInvite(ctx context.Context, codeHash, subject string) (*pbmember.Member, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var counterID string
+	var role pbmember.Role
+	_, span := telemetry.StartQuerySpan(ctx, "DELETE", "invites")
+	err = tx.QueryRowContext(ctx,
+		"DELETE FROM invites WHERE code_hash = $1 AND expires_at > $2 RETURNING counter_id, role",
+		codeHash, s.now().UTC()).Scan(&counterID, &role)
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		return nil, notFound(err)
+	}
+
+	_, span = telemetry.StartQuerySpan(ctx, "INSERT", "members")
+	m, err := scanMember(tx.QueryRowContext(ctx,
+		"INSERT INTO members(counter_id, subject, role) VALUES($1, $2, $3) ON CONFLICT (counter_id, subject) DO UPDATE SET role = MAX(members.role, excluded.role) RETURNING counter_id, subject, role",
+		counterID, subject, role))
+	telemetry.EndSpan(span, err)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := commit(ctx, tx, "members"); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (s *SQLiteStore) CreateKey(ctx context.Context, secretHash string, key *pbkey.Key) (*pbkey.Key, error) {
+	_, span := telemetry.StartQuerySpan(ctx, "INSERT", "api_keys")
+	k, err := scanKey(s.db.QueryRowContext(ctx,
+		"INSERT INTO api_keys(id, secret_hash, subject, name, scopes, counter_ids, created_at, expires_at) VALUES($1, $2, $3, $4, $5, $6, $7, $8) RETURNING "+keyColumns,
+		newUUID(), secretHash, key.Subject, key.Name, joinScopes(key.Scopes), strings.Join(key.CounterIds, " "), s.now().UTC(), nullTime(key.ExpiresAt)))
+	telemetry.EndSpan(span, err)
+	return k, err
+}
+
+func (s *SQLiteStore) GetKey(ctx context.Context, secretHash string) (*pbkey.Key, error) {
+	return getKey(ctx, s.db, secretHash)
+}
+
+func (s *SQLiteStore) ListKeys(ctx context.Context, subject string) ([]*pbkey.Key, error) {
+	return listKeys(ctx, s.db, subject)
+}
+
+func (s *SQLiteStore) DeleteKey(ctx context.Context, subject, id string) error {
+	return deleteKey(ctx, s.db, subject, id)
+}
+
+func (s *SQLiteStore) TouchKey(ctx context.Context, id string, usedAt time.Time) error {
+	return touchKey(ctx, s.db, id, usedAt)
+}
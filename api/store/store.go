@@ -0,0 +1,122 @@
+// Package store keeps counters, their events, who they're shared with and
+// API keys, in postgres, a SQLite file or memory, behind the interfaces the
+// server's handlers use. Migrator creates the schema for the SQL stores.
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	pbcounter "github.com/alextebbs/counters/pb/counter/v1"
+	pbevent "github.com/alextebbs/counters/pb/event/v1"
+	pbkey "github.com/alextebbs/counters/pb/key/v1"
+	pbmember "github.com/alextebbs/counters/pb/member/v1"
+)
+
+// Returned by stores when the counter, event, member or invite asked for
+// doesn't exist.
+var ErrNotFound = errors.New("not found")
+
+// Returned by MemberStore when a change would leave a counter without an
+// owner.
+var ErrLastOwner = errors.New("counter has no other owner")
+
+// Where counters live. Each method is atomic, implementations take care of
+// any transactions.
+//
+// Nothing here checks who is asking, the handlers do that first with
+// MemberStore.GetAccess.
+type CounterStore interface {
+	// CreateCounter adds a counter along with its first event, which has no
+	// previous event to measure a duration from, and makes owner its first
+	// member with ROLE_OWNER.
+	CreateCounter(ctx context.Context, owner, title, eventTitle string) (*pbcounter.Counter, *pbevent.Event, error)
+	GetCounter(ctx context.Context, id string) (*pbcounter.Counter, error)
+	// IncrementCounter bumps the count and adds an event, created by
+	// createdBy, whose duration is the time since the counter's previous
+	// event.
+	IncrementCounter(ctx context.Context, id, createdBy, eventTitle string) (*pbcounter.Counter, *pbevent.Event, error)
+	// DeleteCounter deletes a counter and all of its events, members and
+	// invites, returning the IDs of the events so they can be removed from the
+	// cache.
+	DeleteCounter(ctx context.Context, id string) (eventIDs []string, err error)
+	// CountCounters returns how many counters owner has created, including
+	// ones they've since shared.
+	CountCounters(ctx context.Context, owner string) (int, error)
+}
+
+type EventStore interface {
+	GetEvent(ctx context.Context, id string) (*pbevent.Event, error)
+	// ListEventIDs returns ErrNotFound if the counter doesn't exist.
+	ListEventIDs(ctx context.Context, counterID string) ([]string, error)
+	// CountEvents returns how many of a counter's events were created at or
+	// after since.
+	CountEvents(ctx context.Context, counterID string, since time.Time) (int, error)
+}
+
+// What a user can do with a counter.
+type Access struct {
+	CounterID string
+	// Who created the counter, whose namespace it's cached in, see
+	// cache.OwnerKey.
+	Owner string
+	Role  pbmember.Role
+}
+
+// Who can do what with each counter, subjects being the sub claim of a user's
+// token, or "" when auth is disabled.
+type MemberStore interface {
+	// GetAccess returns ErrNotFound if subject isn't a member of the counter,
+	// or it doesn't exist.
+	GetAccess(ctx context.Context, counterID, subject string) (*Access, error)
+	// ListAccess returns every counter subject is a member of, in a stable
+	// order.
+	ListAccess(ctx context.Context, subject string) ([]*Access, error)
+	ListMembers(ctx context.Context, counterID string) ([]*pbmember.Member, error)
+	// SetMember adds a member or changes their role, returning ErrLastOwner
+	// rather than demote a counter's only owner.
+	SetMember(ctx context.Context, m *pbmember.Member) error
+	// RemoveMember returns ErrNotFound if subject isn't a member, and
+	// ErrLastOwner if they're the only owner.
+	RemoveMember(ctx context.Context, counterID, subject string) error
+
+	// CreateInvite stores an invite, under a hash of its code so the codes
+	// can't be read back out of the database.
+	CreateInvite(ctx context.Context, codeHash string, invite *Invite) error
+	// AcceptInvite uses an invite up, making subject a member with its role
+	// unless they already have a higher one. ErrNotFound if there's no
+	// invite with codeHash, or it has expired.
+	AcceptInvite(ctx context.Context, codeHash, subject string) (*pbmember.Member, error)
+}
+
+// An invite to join a counter.
+type Invite struct {
+	CounterID string
+	Role      pbmember.Role
+	CreatedBy string
+	ExpiresAt time.Time
+}
+
+// API keys, found by a hash of their secrets since the secrets themselves
+// aren't kept.
+type KeyStore interface {
+	// CreateKey stores a key, filling in its ID and created_at.
+	CreateKey(ctx context.Context, secretHash string, key *pbkey.Key) (*pbkey.Key, error)
+	// GetKey returns ErrNotFound if there's no key with secretHash. Expired
+	// keys are still returned.
+	GetKey(ctx context.Context, secretHash string) (*pbkey.Key, error)
+	ListKeys(ctx context.Context, subject string) ([]*pbkey.Key, error)
+	// DeleteKey returns ErrNotFound unless subject has a key with id.
+	DeleteKey(ctx context.Context, subject, id string) error
+	// TouchKey sets a key's last_used_at.
+	TouchKey(ctx context.Context, id string, usedAt time.Time) error
+}
+
+// Everything the handlers need, which each implementation provides.
+type Store interface {
+	CounterStore
+	EventStore
+	MemberStore
+	KeyStore
+}
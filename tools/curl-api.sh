@@ -1,15 +1,29 @@
 #!/bin/bash
 
-# Usage: ./curl-api.sh POST /counter data.json
+# Calls the api's REST routes, which are listed in api/server/openapi/openapi.yaml.
+# Needs the api's web listener, web.listen_addr, on localhost:8080.
+#
+# Usage: ./curl-api.sh METHOD PATH [data.json]
+#
+#   ./curl-api.sh POST /v1/counters create.json
+#   ./curl-api.sh GET /v1/counters
+#   ./curl-api.sh POST /v1/counters/<id>:increment increment.json
 
-# Method
 METHOD=$1
+API_ENDPOINT=$2
 
-# File containing the JSON data
-JSON=$2
+# File containing the JSON body, optional for GET and DELETE
+JSON=$3
 
-# API endpoint URL
-ENDPOINT=$3
+if [ -z "$METHOD" ] || [ -z "$API_ENDPOINT" ]; then
+    echo "Usage: $0 METHOD PATH [data.json]"
+    exit 1
+fi
+
+if [ -z "$JSON" ]; then
+    curl -X "$METHOD" "http://localhost:8080$API_ENDPOINT"
+    exit
+fi
 
 # Check if the file exists
 if [ ! -f "$JSON" ]; then
@@ -17,5 +31,5 @@ if [ ! -f "$JSON" ]; then
     exit 1
 fi
 
-# Send the POST request with the JSON data from the file
-curl -X $METHOD -H "Content-Type: application/json" -d @"$JSON" http://localhost:8080$API_ENDPOINT
+# Send the request with the JSON data from the file
+curl -X "$METHOD" -H "Content-Type: application/json" -d @"$JSON" "http://localhost:8080$API_ENDPOINT"